@@ -2,10 +2,37 @@ package constant
 
 // Static messages
 const (
-	MSG_FORBIDDEN_ACCESS     = "forbidden access"
-	MSG_PERMANENTLY_REDIRECT = "permanently_redirect"
-	MSG_NOT_FOUND            = "not found"
-	MSG_SUCCESS              = "success"
+	MSG_BAD_REQUEST           = "bad request"
+	MSG_UNAUTHORIZED          = "unauthorized"
+	MSG_FORBIDDEN_ACCESS      = "forbidden access"
+	MSG_PERMANENTLY_REDIRECT  = "permanently_redirect"
+	MSG_NOT_FOUND             = "not found"
+	MSG_CONFLICT              = "conflict"
+	MSG_UNPROCESSABLE_ENTITY  = "unprocessable entity"
+	MSG_TOO_MANY_REQUESTS     = "too many requests"
+	MSG_INTERNAL_SERVER_ERROR = "internal server error"
+	MSG_REQUEST_TOO_LARGE     = "request entity too large"
+	MSG_NOT_IMPLEMENTED       = "not implemented"
+	MSG_SERVICE_UNAVAILABLE   = "service unavailable"
+	MSG_GATEWAY_TIMEOUT       = "gateway timeout"
+	MSG_SUCCESS               = "success"
+)
+
+// Error codes, it's stable so client can handle the error without parsing the message
+const (
+	CODE_BAD_REQUEST           = "bad_request"
+	CODE_UNAUTHORIZED          = "unauthorized"
+	CODE_FORBIDDEN             = "forbidden"
+	CODE_PERMANENTLY_REDIRECT  = "permanently_redirect"
+	CODE_NOT_FOUND             = "not_found"
+	CODE_CONFLICT              = "conflict"
+	CODE_UNPROCESSABLE_ENTITY  = "unprocessable_entity"
+	CODE_TOO_MANY_REQUESTS     = "too_many_requests"
+	CODE_INTERNAL_SERVER_ERROR = "internal_server_error"
+	CODE_REQUEST_TOO_LARGE     = "request_entity_too_large"
+	CODE_NOT_IMPLEMENTED       = "not_implemented"
+	CODE_SERVICE_UNAVAILABLE   = "service_unavailable"
+	CODE_GATEWAY_TIMEOUT       = "gateway_timeout"
 )
 
 // Env Keys
@@ -48,6 +75,13 @@ const (
 	YANMAS_JWT_SECRET_KEY = "YANMAS_JWT_SECRET_KEY"
 	YANMAS_HMAC_DATE_KEY  = "YANMAS_HMAC_DATE_KEY"
 
+	JWT_JWKS        = "JWT_JWKS"
+	YANMAS_JWT_JWKS = "YANMAS_JWT_JWKS"
+
+	JWT_SIGNATURE_SKEW          = "JWT_SIGNATURE_SKEW"
+	JWT_SIGNATURE_REQUIRED      = "JWT_SIGNATURE_REQUIRED"
+	JWT_SIGNATURE_MAX_BODY_SIZE = "JWT_SIGNATURE_MAX_BODY_SIZE" // in byte, default 10 MiB
+
 	VAULT_ENABLED      = "VAULT_ENABLED"
 	VAULT_ADDRESS      = "VAULT_ADDRESS"
 	VAULT_TOKEN        = "VAULT_TOKEN"
@@ -58,6 +92,17 @@ const (
 
 	ALLOWED_ORIGINS = "ALLOWED_ORIGINS"
 
+	CURSOR_KEY = "CURSOR_KEY"
+
+	GRPC_HEALTH     = "GRPC_HEALTH"     // true or false, default true
+	GRPC_REFLECTION = "GRPC_REFLECTION" // true or false, default false
+
+	SESSION_CLIENT_CHECK     = "SESSION_CLIENT_CHECK"     // flag or refuse, default empty
+	SESSION_MAX_PER_USER     = "SESSION_MAX_PER_USER"     // default 1
+	SESSION_ABSOLUTE_TIMEOUT = "SESSION_ABSOLUTE_TIMEOUT" // in second, default 24 hours on production and 7 days on others
+	SESSION_IDLE_TIMEOUT     = "SESSION_IDLE_TIMEOUT"     // in second, default 0 (disabled)
+	SESSION_TOUCH_INTERVAL   = "SESSION_TOUCH_INTERVAL"   // in second, default 60
+
 	// Redpanda
 	RP_HOST           = "RP_HOST"
 	RP_PORT           = "RP_PORT"
@@ -7,8 +7,8 @@ import (
 )
 
 type Model struct {
-	ID        string         `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primarykey"`
-	CreatedAt time.Time      `json:"created_at,omitempty"`
-	UpdatedAt time.Time      `json:"updated_at,omitempty"`
+	ID        string         `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primarykey" sort:"id"`
+	CreatedAt time.Time      `json:"created_at,omitempty" sort:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at,omitempty" sort:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
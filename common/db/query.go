@@ -1,9 +1,73 @@
 package db
 
-import "github.com/dzrock1989/perkakas/common/pagination"
+import (
+	"context"
+	"net/http"
+
+	"github.com/dzrock1989/perkakas/common/http_response"
+	"github.com/dzrock1989/perkakas/common/pagination"
+	"gorm.io/gorm"
+)
 
 // Generic Data type for Query
-type Query[T comparable] struct {
+type Query[T any] struct {
 	Data T
 	Meta pagination.Option
 }
+
+// Find validate the option, count and fetch one page of T using the same conditions of conn,
+// use Meta.HttpMeta or Meta.ProtoMeta to build the response
+func Find[T any](ctx context.Context, conn *gorm.DB, opt pagination.Option) (q Query[[]T], err error) {
+	if err = opt.Validate(); err != nil {
+		return
+	}
+
+	var model T
+	conn = conn.Model(&model).Session(&gorm.Session{Context: ctx})
+
+	p := pagination.Pagination{
+		Model:  &model,
+		Option: &opt,
+		DBConn: conn,
+	}
+
+	data := make([]T, 0)
+	if err = conn.Scopes(p.Paginate()).Find(&data).Error; err != nil {
+		return
+	}
+
+	if p.Option.CursorMode || p.Option.Cursor != "" {
+		if err = p.BuildCursor(&data); err != nil {
+			return
+		}
+	}
+
+	q.Data = data
+	q.Meta = opt
+
+	return
+}
+
+// Stream write all rows of T that match filter and sort of the option as json, csv or ndjson
+// based on Accept header of r, the rows is read one by one from database.
+// error is only returned before the response is written
+func Stream[T any](w http.ResponseWriter, r *http.Request, conn *gorm.DB, opt pagination.Option) error {
+	var model T
+	conn = conn.Model(&model).Session(&gorm.Session{Context: r.Context()})
+
+	p := pagination.Pagination{
+		Model:  &model,
+		Option: &opt,
+		DBConn: conn,
+	}
+
+	rows, err := conn.Scopes(p.Query()).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	http_response.SendRows[T](w, r, conn, rows)
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/dzrock1989/perkakas/common/http_response"
+	"github.com/dzrock1989/perkakas/common/pagination"
+	"github.com/dzrock1989/perkakas/common/util"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type testModel struct {
+	Model
+	Nama string `filter:"nama" sort:"nama"`
+}
+
+func dryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestFind(t *testing.T) {
+	db := dryRunDB(t)
+
+	q, err := Find[testModel](context.Background(), db, pagination.Option{Filter: "nama:like:budi", Sort: "nama desc"})
+	require.NoError(t, err)
+	require.Equal(t, []testModel{}, q.Data)
+	require.Equal(t, 1, q.Meta.Page)
+	require.Equal(t, 10, q.Meta.Limit)
+	require.Equal(t, &http_response.Meta{Page: 1, Limit: 10, CountStrategy: "exact"}, q.Meta.HttpMeta())
+	require.EqualValues(t, 10, q.Meta.ProtoMeta().Limit)
+
+	_, err = Find[testModel](context.Background(), db, pagination.Option{Limit: pagination.MaxLimit + 1})
+	require.ErrorIs(t, err, util.ErrValidation)
+
+	// sort of Model is allowed on every model
+	_, err = Find[testModel](context.Background(), db, pagination.Option{Sort: "created_at desc,id"})
+	require.NoError(t, err)
+
+	_, err = Find[testModel](context.Background(), db, pagination.Option{Sort: "deleted_at"})
+	require.ErrorIs(t, err, pagination.ErrInvalidSort)
+
+	_, err = Find[testModel](context.Background(), db, pagination.Option{Filter: "umur:eq:1"})
+	var fe *util.FilterError
+	require.ErrorAs(t, err, &fe)
+}
+
+func TestStream(t *testing.T) {
+	createdAt := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		expected    string
+	}{
+		{
+			name:        "json",
+			accept:      "",
+			contentType: "application/json; charset=utf-8",
+			expected:    `{"status":200,"message":"success","data":[{"id":"1","created_at":"2023-01-02T03:04:05Z","updated_at":"2023-01-02T03:04:05Z","Nama":"budi"},{"id":"2","created_at":"2023-01-02T03:04:05Z","updated_at":"2023-01-02T03:04:05Z","Nama":"=cmd"}]}`,
+		},
+		{
+			name:        "ndjson",
+			accept:      "application/x-ndjson",
+			contentType: "application/x-ndjson",
+			expected: `{"id":"1","created_at":"2023-01-02T03:04:05Z","updated_at":"2023-01-02T03:04:05Z","Nama":"budi"}
+{"id":"2","created_at":"2023-01-02T03:04:05Z","updated_at":"2023-01-02T03:04:05Z","Nama":"=cmd"}
+`,
+		},
+		{
+			name:        "csv",
+			accept:      "text/csv, application/json;q=0.9",
+			contentType: "text/csv; charset=utf-8",
+			expected: `id,created_at,updated_at,Nama
+1,2023-01-02T03:04:05Z,2023-01-02T03:04:05Z,budi
+2,2023-01-02T03:04:05Z,2023-01-02T03:04:05Z,'=cmd
+`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer sqlDB.Close()
+
+			conn, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+			require.NoError(t, err)
+
+			rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "deleted_at", "nama"}).
+				AddRow("1", createdAt, createdAt, nil, "budi").
+				AddRow("2", createdAt, createdAt, nil, "=cmd")
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "test_models" WHERE test_models.nama ILIKE $1 AND "test_models"."deleted_at" IS NULL ORDER BY test_models.nama DESC`)).
+				WithArgs("%b%").
+				WillReturnRows(rows)
+
+			r := httptest.NewRequest(http.MethodGet, "/export", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+
+			err = Stream[testModel](w, r, conn, pagination.Option{Filter: "nama:like:b", Sort: "nama desc"})
+			require.NoError(t, err)
+			require.NoError(t, mock.ExpectationsWereMet())
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			require.Equal(t, tt.expected, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package grpc_server
+
+import (
+	"context"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/dzrock1989/perkakas/common/middlewares/authentication"
+	"github.com/dzrock1989/perkakas/common/middlewares/authorization"
+	"github.com/dzrock1989/perkakas/common/util"
+	"github.com/dzrock1989/perkakas/configs"
+	"github.com/dzrock1989/perkakas/proto"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.elastic.co/apm/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// metadata keys, it's the same as the http header
+const (
+	MetadataAuthorization = "authorization"
+	MetadataDates         = "dates"
+	MetadataNonce         = "nonce"
+	MetadataRequestID     = "x-request-id"
+)
+
+// methods of health and reflection server never need authentication
+var publicServices = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+	"/grpc.reflection.v1.ServerReflection/",
+}
+
+// serverStream replace context of the stream
+type serverStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	validate bool
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if s.validate {
+		return Status(validate(s.ctx, m))
+	}
+
+	return nil
+}
+
+func wrapStream(ss grpc.ServerStream) *serverStream {
+	if s, ok := ss.(*serverStream); ok {
+		return s
+	}
+
+	return &serverStream{ServerStream: ss, ctx: ss.Context()}
+}
+
+// UnaryRecover recover panic of the handler into codes.Internal like middlewares.Recover
+func UnaryRecover(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+	defer recoverPanic(info.FullMethod, &err)
+
+	return handler(ctx, req)
+}
+
+// StreamRecover is UnaryRecover for stream
+func StreamRecover(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer recoverPanic(info.FullMethod, &err)
+
+	return handler(srv, ss)
+}
+
+func recoverPanic(method string, err *error) {
+	if rvr := recover(); rvr != nil {
+		util.Log.Error().Msgf("grpc: panic on %s: %v\n%s", method, rvr, debug.Stack())
+		*err = status.Error(codes.Internal, "internal server error")
+	}
+}
+
+// UnaryAPM start apm transaction of the request when configs.Config.IsUseELK is true
+func UnaryAPM(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !configs.Config.IsUseELK {
+		return handler(ctx, req)
+	}
+
+	ctx, end := startTransaction(ctx, info.FullMethod)
+	res, err := handler(ctx, req)
+	end(err)
+
+	return res, err
+}
+
+// StreamAPM is UnaryAPM for stream
+func StreamAPM(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !configs.Config.IsUseELK {
+		return handler(srv, ss)
+	}
+
+	s := wrapStream(ss)
+	var end func(error)
+	s.ctx, end = startTransaction(s.ctx, info.FullMethod)
+	err := handler(srv, s)
+	end(err)
+
+	return err
+}
+
+func startTransaction(ctx context.Context, method string) (context.Context, func(error)) {
+	trx := apm.DefaultTracer().StartTransaction(method, "request")
+	ctx = apm.ContextWithTransaction(ctx, trx)
+
+	return ctx, func(err error) {
+		code := status.Code(Status(err))
+		trx.Result = code.String()
+		trx.Outcome = "success"
+		if err != nil {
+			trx.Outcome = "failure"
+			apm.CaptureError(ctx, err).Send()
+		}
+		trx.End()
+	}
+}
+
+// UnaryLogging log method, code and latency of the request with util.Log,
+// error of the handler is converted with Status
+func UnaryLogging(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx = withRequestID(ctx)
+
+	start := time.Now()
+	res, err := handler(ctx, req)
+	err = Status(err)
+	logRequest(ctx, info.FullMethod, start, err)
+
+	return res, err
+}
+
+// StreamLogging is UnaryLogging for stream
+func StreamLogging(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	s := wrapStream(ss)
+	s.ctx = withRequestID(s.ctx)
+
+	start := time.Now()
+	err := Status(handler(srv, s))
+	logRequest(s.ctx, info.FullMethod, start, err)
+
+	return err
+}
+
+// withRequestID use request id of the caller, the same as chi middleware.RequestID
+func withRequestID(ctx context.Context) context.Context {
+	if id := metadataValue(ctx, MetadataRequestID); id != "" {
+		return context.WithValue(ctx, middleware.RequestIDKey, id)
+	}
+
+	return ctx
+}
+
+func logRequest(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+
+	event := util.Log.Info()
+	if code == codes.Internal || code == codes.Unknown {
+		event = util.Log.Error().Str("error", err.Error())
+	}
+
+	event.Str("method", method).
+		Str("code", code.String()).
+		Str("request_id", middleware.GetReqID(ctx)).
+		Dur("latency", time.Since(start)).
+		Msg("grpc request")
+}
+
+// UnaryAuthentication validate authorization, dates and nonce metadata with authentication.AuthenticateCall,
+// authorization field of *proto.Requests is used when the metadata is empty.
+// the nonce signature is of authenticator.MethodRPC, the full method and the deterministic marshal of the request,
+// or the data of *proto.Requests for its authorization field, see authentication.ForwardRPC.
+// the claims is added to context under util.ContextClaims
+func UnaryAuthentication(opts Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !opts.Authentication || opts.isPublic(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		var err error
+		if r, ok := req.(*proto.Requests); ok && metadataValue(ctx, MetadataAuthorization) == "" {
+			ctx, err = authentication.AuthenticateRPC(ctx, r.GetAuthorization(), info.FullMethod, r.GetData(), opts.IsThereAJwt)
+		} else {
+			ctx, err = authenticate(ctx, opts, info.FullMethod, req)
+		}
+		if err != nil {
+			return nil, Status(err)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthentication is UnaryAuthentication for stream, only the metadata is used
+// and the signed body is empty because the messages is received after the authentication
+func StreamAuthentication(opts Options) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !opts.Authentication || opts.isPublic(info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		s := wrapStream(ss)
+		ctx, err := authenticate(s.ctx, opts, info.FullMethod, nil)
+		if err != nil {
+			return Status(err)
+		}
+		s.ctx = ctx
+
+		return handler(srv, s)
+	}
+}
+
+func authenticate(ctx context.Context, opts Options, fullMethod string, req any) (context.Context, error) {
+	var body []byte
+	if m, ok := req.(protobuf.Message); ok {
+		var err error
+		if body, err = (protobuf.MarshalOptions{Deterministic: true}).Marshal(m); err != nil {
+			return ctx, err
+		}
+	}
+
+	return authentication.AuthenticateCall(ctx, authentication.Credential{
+		Authorization: metadataValue(ctx, MetadataAuthorization),
+		Dates:         metadataValue(ctx, MetadataDates),
+		Nonce:         metadataValue(ctx, MetadataNonce),
+	}, fullMethod, body, opts.IsThereAJwt)
+}
+
+// UnaryAuthorization check permission of the method from Options.Permission with authorization.Authorize
+func UnaryAuthorization(opts Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := opts.authorize(ctx, info.FullMethod); err != nil {
+			return nil, Status(err)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthorization is UnaryAuthorization for stream
+func StreamAuthorization(opts Options) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := opts.authorize(ss.Context(), info.FullMethod); err != nil {
+			return Status(err)
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func (opts Options) authorize(ctx context.Context, fullMethod string) error {
+	if opts.Permission == nil || opts.isPublic(fullMethod) {
+		return nil
+	}
+
+	method, path, ok := opts.Permission(fullMethod)
+	if !ok {
+		return nil
+	}
+
+	return authorization.Authorize(ctx, opts.GetRedis, method, path)
+}
+
+// UnaryValidation validate the request with util.ValidateStruct,
+// request that is not a struct is skipped
+func UnaryValidation(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := validate(ctx, req); err != nil {
+		return nil, Status(err)
+	}
+
+	return handler(ctx, req)
+}
+
+// StreamValidation validate every received message
+func StreamValidation(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	s := wrapStream(ss)
+	s.validate = true
+
+	return handler(srv, s)
+}
+
+func validate(ctx context.Context, req any) error {
+	t := reflect.TypeOf(req)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	return util.ValidateStruct(ctx, req)
+}
+
+func (opts Options) isPublic(fullMethod string) bool {
+	for _, prefix := range publicServices {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return true
+		}
+	}
+
+	for _, method := range opts.PublicMethods {
+		if method == fullMethod {
+			return true
+		}
+	}
+
+	return false
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
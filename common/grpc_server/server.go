@@ -0,0 +1,102 @@
+package grpc_server
+
+import (
+	"net"
+
+	"github.com/dzrock1989/perkakas/common/middlewares/authorization"
+	"github.com/dzrock1989/perkakas/configs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+type Options struct {
+	// Authentication validate the credential of every method except PublicMethods
+	Authentication bool
+	// IsThereAJwt is the same as authentication.Authentication
+	IsThereAJwt bool
+
+	// PublicMethods is full method that skip authentication and authorization,
+	// ex: /user.UserService/Login. health and reflection is always public
+	PublicMethods []string
+
+	// Permission return http method (POST, GET, PATCH or DELETE) and permission key of full method,
+	// authorization is skipped when Permission is nil or ok is false
+	Permission func(fullMethod string) (method, path string, ok bool)
+	// GetRedis is passed to authorization.Authorize, nil use the default
+	GetRedis authorization.GetRedis
+
+	// UnaryInterceptors and StreamInterceptors is called after the built in interceptors
+	UnaryInterceptors  []grpc.UnaryServerInterceptor
+	StreamInterceptors []grpc.StreamServerInterceptor
+
+	ServerOptions []grpc.ServerOption
+}
+
+// Server is grpc.Server with the health server,
+// Health is nil when configs.Config.GRPCHealth is false
+type Server struct {
+	*grpc.Server
+	Health *health.Server
+}
+
+// New create grpc server with interceptors in order of
+// recover, apm, logging, authentication, authorization and validation.
+// health and reflection server is registered based on configs
+func New(opts Options) *Server {
+	unary := append([]grpc.UnaryServerInterceptor{
+		UnaryRecover,
+		UnaryAPM,
+		UnaryLogging,
+		UnaryAuthentication(opts),
+		UnaryAuthorization(opts),
+		UnaryValidation,
+	}, opts.UnaryInterceptors...)
+
+	stream := append([]grpc.StreamServerInterceptor{
+		StreamRecover,
+		StreamAPM,
+		StreamLogging,
+		StreamAuthentication(opts),
+		StreamAuthorization(opts),
+		StreamValidation,
+	}, opts.StreamInterceptors...)
+
+	serverOptions := append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}, opts.ServerOptions...)
+
+	s := &Server{Server: grpc.NewServer(serverOptions...)}
+
+	if configs.Config.GRPCHealth {
+		s.Health = health.NewServer()
+		grpc_health_v1.RegisterHealthServer(s.Server, s.Health)
+	}
+
+	if configs.Config.GRPCReflection {
+		reflection.Register(s.Server)
+	}
+
+	return s
+}
+
+// ListenAndServe serve on configs.Config.GRPCPort
+func (s *Server) ListenAndServe() error {
+	lis, err := net.Listen("tcp", ":"+configs.Config.GRPCPort)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(lis)
+}
+
+// Shutdown set every service to not serving and wait the running requests to finish
+func (s *Server) Shutdown() {
+	if s.Health != nil {
+		s.Health.Shutdown()
+	}
+
+	s.GracefulStop()
+}
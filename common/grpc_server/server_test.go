@@ -0,0 +1,290 @@
+package grpc_server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/dzrock1989/perkakas/common/middlewares/authentication"
+	"github.com/dzrock1989/perkakas/common/middlewares/authentication/authenticationtest"
+	"github.com/dzrock1989/perkakas/common/middlewares/authenticator"
+	"github.com/dzrock1989/perkakas/common/middlewares/authorization"
+	"github.com/dzrock1989/perkakas/configs"
+	"github.com/dzrock1989/perkakas/proto"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	protobuf "google.golang.org/protobuf/proto"
+	"gorm.io/gorm"
+)
+
+// test service without generated code, Echo reply the uuid or user uuid from claims
+// and Count reply the number of received request
+var testServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Test",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Echo", Handler: echoHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Count", Handler: countHandler, ServerStreams: true, ClientStreams: true},
+	},
+}
+
+func echo(ctx context.Context, req *proto.Requests) (*proto.Responses, error) {
+	switch req.GetUuid() {
+	case "panic":
+		panic("boom")
+	case "missing":
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if claims, ok := authorization.ClaimsFromContext(ctx); ok {
+		return &proto.Responses{Message: claims.UserUUID}, nil
+	}
+
+	return &proto.Responses{Message: req.GetUuid()}, nil
+}
+
+func echoHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(proto.Requests)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		return echo(ctx, req.(*proto.Requests))
+	}
+
+	return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/test.Test/Echo"}, handler)
+}
+
+func countHandler(srv any, stream grpc.ServerStream) error {
+	var n int32
+	for {
+		err := stream.RecvMsg(new(proto.Requests))
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		n++
+	}
+
+	claims, _ := authorization.ClaimsFromContext(stream.Context())
+	return stream.SendMsg(&proto.Responses{Status: n, Message: claims.UserUUID})
+}
+
+func newTestServer(t *testing.T, opts Options) *grpc.ClientConn {
+	lis := bufconn.Listen(1024 * 1024)
+
+	configs.Config.GRPCHealth = true
+	s := New(opts)
+	s.RegisterService(&testServiceDesc, struct{}{})
+	go s.Serve(lis)
+	t.Cleanup(s.Shutdown)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func invokeEcho(ctx context.Context, conn *grpc.ClientConn, uuid string) (*proto.Responses, error) {
+	res := new(proto.Responses)
+	err := conn.Invoke(ctx, "/test.Test/Echo", &proto.Requests{Uuid: uuid}, res)
+
+	return res, err
+}
+
+// credential return authorization and dates metadata of the legacy signature
+func credential(t *testing.T) context.Context {
+	date := authenticationtest.Date()
+
+	return metadata.AppendToOutgoingContext(context.Background(),
+		MetadataAuthorization, authenticationtest.Legacy(t, date),
+		MetadataDates, date,
+	)
+}
+
+func TestServer(t *testing.T) {
+	conn := newTestServer(t, Options{})
+	ctx := context.Background()
+
+	res, err := invokeEcho(ctx, conn, "abc")
+	require.NoError(t, err)
+	require.Equal(t, "abc", res.GetMessage())
+
+	// error is mapped with the error registry of http_response
+	_, err = invokeEcho(ctx, conn, "missing")
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.Equal(t, `not found: "record not found"`, status.Convert(err).Message())
+
+	_, err = invokeEcho(ctx, conn, "panic")
+	require.Equal(t, codes.Internal, status.Code(err))
+
+	// the server still serve after panic
+	health, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, health.GetStatus())
+}
+
+func TestHealthAndReflection(t *testing.T) {
+	healthEnabled, reflectionEnabled := configs.Config.GRPCHealth, configs.Config.GRPCReflection
+	defer func() { configs.Config.GRPCHealth, configs.Config.GRPCReflection = healthEnabled, reflectionEnabled }()
+
+	configs.Config.GRPCHealth, configs.Config.GRPCReflection = false, false
+	s := New(Options{})
+	require.Nil(t, s.Health)
+	require.Empty(t, s.GetServiceInfo())
+
+	configs.Config.GRPCHealth, configs.Config.GRPCReflection = true, true
+	s = New(Options{})
+	require.NotNil(t, s.Health)
+	require.Contains(t, s.GetServiceInfo(), "grpc.health.v1.Health")
+	require.Contains(t, s.GetServiceInfo(), "grpc.reflection.v1alpha.ServerReflection")
+}
+
+func TestAuthentication(t *testing.T) {
+	authenticationtest.Setup(t)
+
+	conn := newTestServer(t, Options{Authentication: true, IsThereAJwt: true})
+
+	_, err := invokeEcho(context.Background(), conn, "abc")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	res, err := invokeEcho(credential(t), conn, "abc")
+	require.NoError(t, err)
+	require.Equal(t, authenticationtest.UserUUID, res.GetMessage())
+
+	// health is always public
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	// stream
+	desc := &testServiceDesc.Streams[0]
+	count := func(ctx context.Context) (*proto.Responses, error) {
+		stream, err := conn.NewStream(ctx, desc, "/test.Test/Count")
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			if err = stream.SendMsg(&proto.Requests{}); err != nil {
+				break
+			}
+		}
+		require.NoError(t, stream.CloseSend())
+
+		res := new(proto.Responses)
+		return res, stream.RecvMsg(res)
+	}
+
+	_, err = count(context.Background())
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	res, err = count(credential(t))
+	require.NoError(t, err)
+	require.Equal(t, int32(3), res.GetStatus())
+	require.Equal(t, authenticationtest.UserUUID, res.GetMessage())
+}
+
+func TestAuthorization(t *testing.T) {
+	getRedis := func(ctx context.Context, key string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}
+
+	conn := newTestServer(t, Options{
+		Permission: func(fullMethod string) (string, string, bool) {
+			return http.MethodGet, "test.echo", fullMethod == "/test.Test/Echo"
+		},
+		GetRedis: getRedis,
+	})
+
+	// without claims
+	_, err := invokeEcho(context.Background(), conn, "abc")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// method without permission is not checked
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+}
+
+func TestValidation(t *testing.T) {
+	type request struct {
+		Email string `validate:"required,email"`
+	}
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Test/Validate"}
+
+	_, err := UnaryValidation(context.Background(), &request{Email: "bukan email"}, info, handler)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	res, err := UnaryValidation(context.Background(), &request{Email: "budi@example.com"}, info, handler)
+	require.NoError(t, err)
+	require.Equal(t, "ok", res)
+}
+
+func TestAuthenticationSignatureRequired(t *testing.T) {
+	authenticationtest.Setup(t)
+	authenticationtest.RequireSignature(t)
+
+	conn := newTestServer(t, Options{Authentication: true, IsThereAJwt: true})
+
+	// legacy signature of the date only
+	_, err := invokeEcho(credential(t), conn, "abc")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// the signature is of the full method and the request
+	signed := func(nonce, fullMethod string, req *proto.Requests) context.Context {
+		body, err := (protobuf.MarshalOptions{Deterministic: true}).Marshal(req)
+		require.NoError(t, err)
+
+		date := authenticationtest.Date()
+		return metadata.AppendToOutgoingContext(context.Background(),
+			MetadataAuthorization, authenticationtest.Signed(t, authenticator.MethodRPC, fullMethod, date, nonce, body),
+			MetadataDates, date,
+			MetadataNonce, nonce,
+		)
+	}
+
+	ctx := signed("0123456789abcdef", "/test.Test/Echo", &proto.Requests{Uuid: "abc"})
+	res, err := invokeEcho(ctx, conn, "abc")
+	require.NoError(t, err)
+	require.Equal(t, authenticationtest.UserUUID, res.GetMessage())
+
+	// replayed
+	_, err = invokeEcho(ctx, conn, "abc")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// the credential is for other request or method
+	_, err = invokeEcho(signed("0123456789abcde0", "/test.Test/Echo", &proto.Requests{Uuid: "abc"}), conn, "xyz")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = invokeEcho(signed("0123456789abcde1", "/test.Test/Delete", &proto.Requests{Uuid: "abc"}), conn, "abc")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// http request that is authenticated by the gateway and forwarded in authorization of the request
+	r := authenticationtest.Request(t, http.MethodGet, "/users", "", "0123456789abcde2")
+	_, err = authentication.Authenticator.AuthenticateRequest(r, true)
+	require.NoError(t, err)
+
+	req := &proto.Requests{Data: []byte(`{"nama":"budi"}`)}
+	req.Authorization = authentication.ForwardRPC(authentication.CredentialFromRequest(r), "/test.Test/Echo", req.Data)
+	res = new(proto.Responses)
+	require.NoError(t, conn.Invoke(context.Background(), "/test.Test/Echo", req, res))
+	require.Equal(t, authenticationtest.UserUUID, res.GetMessage())
+}
@@ -0,0 +1,51 @@
+package grpc_server
+
+import (
+	"net/http"
+
+	"github.com/dzrock1989/perkakas/common/http_response"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var httpCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.AlreadyExists,
+	http.StatusUnprocessableEntity: codes.FailedPrecondition,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	http.StatusNotImplemented:      codes.Unimplemented,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+	// session not found, the client must login again
+	http.StatusPermanentRedirect: codes.Unauthenticated,
+}
+
+// Status convert err into grpc status error using the error registry of http_response,
+// message is the message of the status and the debug is added when it's not production.
+// grpc status error is returned as is
+func Status(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	e := http_response.ToError(err)
+
+	code, ok := httpCodes[e.Status]
+	if !ok {
+		code = codes.Internal
+	}
+
+	msg := e.Message
+	if debug := e.ToProto().GetDebug(); len(debug) > 0 {
+		msg += ": " + string(debug)
+	}
+
+	return status.Error(code, msg)
+}
@@ -0,0 +1,88 @@
+package http_response
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cache-Control presets for SendSuccess
+const (
+	// CacheControlReference is for reference data that is the same for every user
+	// and rarely changes, ex: wilayah, kepolisian, pekerjaan
+	CacheControlReference = "public, max-age=3600, must-revalidate"
+	// CacheControlUser is for data of the logged in user,
+	// it's only cached by browser and always revalidated with ETag
+	CacheControlUser = "private, no-cache"
+	// CacheControlNoStore is for sensitive data that must not be cached
+	CacheControlNoStore = "no-store"
+)
+
+// SuccessOption is optional behaviour of SendSuccess
+type SuccessOption func(*successOption)
+
+type successOption struct {
+	r            *http.Request
+	etag         string
+	bodyETag     bool
+	cacheControl string
+}
+
+// WithETag compute strong ETag from the response body,
+// 304 is sent when If-None-Match of r match the ETag
+func WithETag(r *http.Request) SuccessOption {
+	return func(o *successOption) {
+		o.r = r
+		o.bodyETag = true
+	}
+}
+
+// WithVersionETag use weak ETag from updatedAt (ex: latest UpdatedAt of the data), count of the rows and url of r.
+// the count changes when a row is deleted, that doesn't change the latest UpdatedAt.
+// 304 is sent without marshalling the data when If-None-Match of r match the ETag
+func WithVersionETag(r *http.Request, updatedAt time.Time, count int64) SuccessOption {
+	return func(o *successOption) {
+		o.r = r
+		o.etag = `W/"` + hashETag([]byte(r.URL.RequestURI()+" "+strconv.FormatInt(updatedAt.UnixNano(), 10)+" "+strconv.FormatInt(count, 10))) + `"`
+	}
+}
+
+// WithCacheControl set Cache-Control header, ex: CacheControlReference
+func WithCacheControl(value string) SuccessOption {
+	return func(o *successOption) {
+		o.cacheControl = value
+	}
+}
+
+func hashETag(b []byte) string {
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// notModified check If-None-Match of GET and HEAD request using weak comparison
+func (o successOption) notModified() bool {
+	if o.r == nil || o.etag == "" || (o.r.Method != http.MethodGet && o.r.Method != http.MethodHead) {
+		return false
+	}
+
+	for _, v := range strings.Split(o.r.Header.Get("If-None-Match"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == strings.TrimPrefix(o.etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o successOption) setHeader(w http.ResponseWriter) {
+	if o.etag != "" {
+		w.Header().Set("ETag", o.etag)
+	}
+	if o.cacheControl != "" {
+		w.Header().Set("Cache-Control", o.cacheControl)
+	}
+}
@@ -0,0 +1,148 @@
+package http_response
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dzrock1989/perkakas/common/constant"
+	"github.com/dzrock1989/perkakas/common/util"
+)
+
+// ProblemJSON render error response as application/problem+json (RFC 7807)
+// instead of the HttpResponse envelope
+var ProblemJSON = false
+
+// Error is typed application error, it's rendered by SendErrorResponse
+type Error struct {
+	// Status is http status code
+	Status int
+	// Code is stable machine readable code, ex: not_found
+	Code    string
+	Message string
+	// Detail is rendered as debug, ex: error, validator.ValidationErrors
+	Detail any
+}
+
+// Problem is the body of application/problem+json
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// extension members
+	Code   string `json:"code"`
+	Errors any    `json:"errors,omitempty"`
+}
+
+var statusErrors = map[int]Error{
+	http.StatusPermanentRedirect:     {Code: constant.CODE_PERMANENTLY_REDIRECT, Message: constant.MSG_PERMANENTLY_REDIRECT},
+	http.StatusBadRequest:            {Code: constant.CODE_BAD_REQUEST, Message: constant.MSG_BAD_REQUEST},
+	http.StatusUnauthorized:          {Code: constant.CODE_UNAUTHORIZED, Message: constant.MSG_UNAUTHORIZED},
+	http.StatusForbidden:             {Code: constant.CODE_FORBIDDEN, Message: constant.MSG_FORBIDDEN_ACCESS},
+	http.StatusNotFound:              {Code: constant.CODE_NOT_FOUND, Message: constant.MSG_NOT_FOUND},
+	http.StatusConflict:              {Code: constant.CODE_CONFLICT, Message: constant.MSG_CONFLICT},
+	http.StatusUnprocessableEntity:   {Code: constant.CODE_UNPROCESSABLE_ENTITY, Message: constant.MSG_UNPROCESSABLE_ENTITY},
+	http.StatusRequestEntityTooLarge: {Code: constant.CODE_REQUEST_TOO_LARGE, Message: constant.MSG_REQUEST_TOO_LARGE},
+	http.StatusTooManyRequests:       {Code: constant.CODE_TOO_MANY_REQUESTS, Message: constant.MSG_TOO_MANY_REQUESTS},
+	http.StatusInternalServerError:   {Code: constant.CODE_INTERNAL_SERVER_ERROR, Message: constant.MSG_INTERNAL_SERVER_ERROR},
+	http.StatusNotImplemented:        {Code: constant.CODE_NOT_IMPLEMENTED, Message: constant.MSG_NOT_IMPLEMENTED},
+	http.StatusServiceUnavailable:    {Code: constant.CODE_SERVICE_UNAVAILABLE, Message: constant.MSG_SERVICE_UNAVAILABLE},
+	http.StatusGatewayTimeout:        {Code: constant.CODE_GATEWAY_TIMEOUT, Message: constant.MSG_GATEWAY_TIMEOUT},
+}
+
+// NewError return Error with default code and message of the status,
+// unknown status (ex: zero status of util.ErrorStruct) is internal server error
+func NewError(status int, detail any) *Error {
+	e, ok := statusErrors[status]
+	if !ok {
+		status = http.StatusInternalServerError
+		e = statusErrors[status]
+	}
+
+	e.Status = status
+	e.Detail = detail
+
+	return &e
+}
+
+func (e *Error) Error() string {
+	if err, ok := e.Detail.(error); ok {
+		return e.Message + ": " + err.Error()
+	}
+
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	err, _ := e.Detail.(error)
+	return err
+}
+
+// SendErrorResponse is the single path to render error response,
+// ProblemJSON decide whether it's rendered as envelope or problem+json
+func SendErrorResponse(w http.ResponseWriter, e *Error) {
+	writeError(w, e, ProblemJSON)
+}
+
+func writeError(w http.ResponseWriter, e *Error, problem bool) {
+	if !problem {
+		writeJSON(w, "application/json; charset=utf-8", e.Status, HttpResponse{
+			Status:  e.Status,
+			Message: e.Message,
+			Code:    e.Code,
+			Data:    nil,
+			Debug:   validateErrorMessage(e.Detail),
+		})
+		return
+	}
+
+	p := Problem{
+		Type:   "about:blank",
+		Title:  e.Message,
+		Status: e.Status,
+		Code:   e.Code,
+	}
+
+	if d := validateErrorMessage(e.Detail); d != nil {
+		if msg, ok := d.ErrorMessage.(string); ok {
+			p.Detail = msg
+		} else {
+			p.Errors = d.ErrorMessage
+		}
+	}
+
+	writeJSON(w, "application/problem+json", e.Status, p)
+}
+
+func writeJSON(w http.ResponseWriter, contentType string, statusCode int, body any) {
+	res, err := json.Marshal(body)
+	if err != nil {
+		util.Log.Error().Msg(err.Error())
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(statusCode)
+	w.Write(res)
+}
+
+func SendUnauthorizedResponse(w http.ResponseWriter, errorMessage any) {
+	SendErrorResponse(w, NewError(http.StatusUnauthorized, errorMessage))
+}
+
+func SendConflictResponse(w http.ResponseWriter, errorMessage any) {
+	SendErrorResponse(w, NewError(http.StatusConflict, errorMessage))
+}
+
+func SendUnprocessableEntityResponse(w http.ResponseWriter, errorMessage any) {
+	SendErrorResponse(w, NewError(http.StatusUnprocessableEntity, errorMessage))
+}
+
+func SendTooManyRequestsResponse(w http.ResponseWriter, errorMessage any) {
+	SendErrorResponse(w, NewError(http.StatusTooManyRequests, errorMessage))
+}
+
+func SendInternalServerErrorResponse(w http.ResponseWriter, errorMessage any) {
+	SendErrorResponse(w, NewError(http.StatusInternalServerError, errorMessage))
+}
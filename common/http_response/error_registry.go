@@ -0,0 +1,136 @@
+package http_response
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dzrock1989/perkakas/common/util"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// ErrorMapper convert err into Error, ok is false when err is not handled by the mapper
+type ErrorMapper func(err error) (e *Error, ok bool)
+
+var (
+	registryMu    sync.RWMutex
+	errorRegistry []ErrorMapper
+)
+
+func init() {
+	RegisterErrorMapper(func(err error) (*Error, bool) {
+		// ex: *pgconn.PgError
+		var pgErr interface{ SQLState() string }
+		if errors.As(err, &pgErr) && pgErr.SQLState() == "23505" {
+			return NewError(http.StatusConflict, err), true
+		}
+		return nil, false
+	})
+
+	RegisterError(gorm.ErrRecordNotFound, http.StatusNotFound)
+	RegisterError(gorm.ErrInvalidData, http.StatusBadRequest)
+	RegisterError(util.ErrJsonInvalid, http.StatusBadRequest)
+	RegisterError(util.ErrValidation, http.StatusBadRequest)
+
+	RegisterErrorMapper(func(err error) (*Error, bool) {
+		var errs validator.ValidationErrors
+		if errors.As(err, &errs) {
+			return NewError(http.StatusBadRequest, errs), true
+		}
+		return nil, false
+	})
+
+	RegisterErrorMapper(func(err error) (*Error, bool) {
+		var filterErr *util.FilterError
+		if errors.As(err, &filterErr) {
+			return NewError(http.StatusBadRequest, filterErr), true
+		}
+		return nil, false
+	})
+
+	RegisterErrorMapper(func(err error) (*Error, bool) {
+		var errStruct *util.ErrorStruct
+		if !errors.As(err, &errStruct) {
+			return nil, false
+		}
+
+		e := NewError(errStruct.Status, errStruct.Err)
+		if errStruct.Message != "" {
+			e.Message = errStruct.Message
+		}
+
+		// the wrapped error can be more specific, ex: validator.ValidationErrors
+		if errStruct.Err != nil {
+			if inner, ok := lookUpError(errStruct.Err); ok {
+				e.Detail = inner.Detail
+			}
+		}
+
+		return e, true
+	})
+}
+
+// RegisterErrorMapper add mapper to the registry,
+// the last registered mapper is checked first so it can override the built in
+func RegisterErrorMapper(m ErrorMapper) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	errorRegistry = append([]ErrorMapper{m}, errorRegistry...)
+}
+
+// RegisterError map sentinel error (checked with errors.Is) into status,
+// code and message is the default of the status
+func RegisterError(target error, status int) {
+	RegisterErrorMapper(func(err error) (*Error, bool) {
+		if errors.Is(err, target) {
+			return NewError(status, err), true
+		}
+		return nil, false
+	})
+}
+
+// ToError convert err into Error using the registry,
+// err that is not registered is internal server error
+func ToError(err error) *Error {
+	if e, ok := lookUpError(err); ok {
+		return e
+	}
+
+	return NewError(http.StatusInternalServerError, err)
+}
+
+// lookUpError return the explicit *Error in err chain first,
+// so the registered sentinel that it wraps can't override its status and code
+func lookUpError(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+
+	registryMu.RLock()
+	registry := errorRegistry
+	registryMu.RUnlock()
+
+	for _, m := range registry {
+		if e, ok := m(err); ok {
+			return e, true
+		}
+	}
+
+	return nil, false
+}
+
+// SendError render err with status, message and code from the registry,
+// problem+json is used when ProblemJSON is true or client accept it
+func SendError(w http.ResponseWriter, r *http.Request, err error) {
+	e := ToError(err)
+	if e.Status >= http.StatusInternalServerError {
+		util.Log.Error().Msg(err.Error())
+	}
+
+	problem := ProblemJSON || (r != nil && strings.Contains(r.Header.Get("Accept"), "application/problem+json"))
+	writeError(w, e, problem)
+}
@@ -2,16 +2,19 @@ package http_response
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/dzrock1989/perkakas/common/constant"
 	"github.com/dzrock1989/perkakas/common/util"
+	"github.com/dzrock1989/perkakas/configs"
+	"github.com/go-playground/validator/v10"
 )
 
 type HttpResponse struct {
 	Status  int    `json:"status"`
 	Message string `json:"message"`
+	Code    string `json:"code,omitempty"` // machine readable code of error response, see Error.Code
 	Data    any    `json:"data"`
 	Meta    *Meta  `json:"meta,omitempty"`
 	Debug   *debug `json:"debug,omitempty"`
@@ -19,8 +22,16 @@ type HttpResponse struct {
 
 type Meta struct {
 	Page      int `json:"page"`
+	Limit     int `json:"limit,omitempty"`
 	TotalPage int `json:"total_page"`
 	TotalData int `json:"total_data"`
+
+	// cursor pagination
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+
+	// how total_data is counted (exact, estimate, capped or cached)
+	CountStrategy string `json:"count_strategy,omitempty"`
 }
 
 type debug struct {
@@ -28,38 +39,32 @@ type debug struct {
 	ErrorMessage any  `json:"error_message"`
 }
 
+// Deprecated: use SendProtoResponse to forward proto.Responses
 func SendFromNatsResponse(w http.ResponseWriter, statusCode int, message string, data []byte, meta *Meta, debugMessage []byte) {
-	response := HttpResponse{
+	writeJSON(w, "application/json; charset=utf-8", statusCode, HttpResponse{
 		Status:  statusCode,
 		Message: message,
-		Data:    json.RawMessage(data),
+		Code:    statusErrors[statusCode].Code,
+		Data:    rawData(data),
 		Meta:    meta,
-	}
-	if len(debugMessage) > 0 {
-		if debugMessage[0] == '{' || debugMessage[0] == '[' {
-			response.Debug = &debug{
-				Error:        true,
-				ErrorMessage: json.RawMessage(debugMessage),
-			}
-		} else {
-			response.Debug = &debug{
-				Error:        true,
-				ErrorMessage: string(debugMessage),
-			}
-		}
-	}
+		Debug:   debugFromBytes(debugMessage),
+	})
+}
 
-	b, err := json.Marshal(response)
-	if err != nil {
-		util.Log.Error().Msg(err.Error())
+// SendSuccess send data with status 200,
+// use opts to add ETag (304 on matched If-None-Match) and Cache-Control
+func SendSuccess(w http.ResponseWriter, data any, meta *Meta, errorMessage any, opts ...SuccessOption) {
+	var o successOption
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(statusCode)
-	w.Write(b)
-}
+	if o.notModified() {
+		o.setHeader(w)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 
-func SendSuccess(w http.ResponseWriter, data any, meta *Meta, errorMessage any) {
 	successResponse := HttpResponse{
 		Status:  200,
 		Message: constant.MSG_SUCCESS,
@@ -73,58 +78,41 @@ func SendSuccess(w http.ResponseWriter, data any, meta *Meta, errorMessage any)
 		SendForbiddenResponse(w, nil)
 		return
 	}
+
+	if o.bodyETag {
+		o.etag = `"` + hashETag(res) + `"`
+		if o.notModified() {
+			o.setHeader(w)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	o.setHeader(w)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write(res)
 }
 
-func SendForbiddenResponse(w http.ResponseWriter, errorMessage any) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusForbidden)
-
-	forbiddenResponse := HttpResponse{
-		Status:  http.StatusForbidden,
-		Message: constant.MSG_FORBIDDEN_ACCESS,
-		Data:    nil,
-		Debug:   validateErrorMessage(errorMessage),
-	}
+func SendBadRequestResponse(w http.ResponseWriter, errorMessage any) {
+	SendErrorResponse(w, NewError(http.StatusBadRequest, errorMessage))
+}
 
-	res, _ := json.Marshal(forbiddenResponse)
-	w.Write(res)
+func SendForbiddenResponse(w http.ResponseWriter, errorMessage any) {
+	SendErrorResponse(w, NewError(http.StatusForbidden, errorMessage))
 }
 
 func SendNotFoundResponse(w http.ResponseWriter, errorMessage any) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusNotFound)
-
-	notFoundResponse := HttpResponse{
-		Status:  http.StatusNotFound,
-		Message: constant.MSG_NOT_FOUND,
-		Data:    nil,
-		Debug:   validateErrorMessage(errorMessage),
-	}
-
-	res, _ := json.Marshal(notFoundResponse)
-	w.Write(res)
+	SendErrorResponse(w, NewError(http.StatusNotFound, errorMessage))
 }
 
 func SendRedirectResponse(w http.ResponseWriter, errorMessage any) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusPermanentRedirect)
-
-	forbiddenResponse := HttpResponse{
-		Status:  http.StatusForbidden,
-		Message: constant.MSG_PERMANENTLY_REDIRECT,
-		Data:    nil,
-		Debug:   validateErrorMessage(errorMessage),
-	}
-
-	res, _ := json.Marshal(forbiddenResponse)
-	w.Write(res)
+	SendErrorResponse(w, NewError(http.StatusPermanentRedirect, errorMessage))
 }
 
+// validateErrorMessage return debug of the response, debug is hidden on production
 func validateErrorMessage(errorMessage any) *debug {
-	if errorMessage == nil {
+	if errorMessage == nil || configs.Config.IsProduction() {
 		return nil
 	}
 
@@ -138,6 +126,14 @@ func validateErrorMessage(errorMessage any) *debug {
 
 	err, ok := errorMessage.(error)
 	if ok {
+		var filterErr *util.FilterError
+		if errors.As(err, &filterErr) {
+			return &debug{
+				Error:        true,
+				ErrorMessage: filterErr,
+			}
+		}
+
 		errorMessage = err.Error()
 	}
 
@@ -1,18 +1,27 @@
 package http_response
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/dzrock1989/perkakas/common/constant"
 	"github.com/dzrock1989/perkakas/common/test"
 	"github.com/dzrock1989/perkakas/common/util"
 	"github.com/dzrock1989/perkakas/configs"
+	"github.com/dzrock1989/perkakas/proto"
+	"github.com/google/uuid"
+	protobuf "google.golang.org/protobuf/proto"
+	"gorm.io/gorm"
 )
 
 type testValidation struct {
@@ -38,6 +47,27 @@ func newServer() *http.ServeMux {
 		SendNotFoundResponse(w, errors.New("just message"))
 	}))
 
+	router.HandleFunc("/bad-request", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type filterModel struct {
+			Umur int `filter:"umur"`
+		}
+
+		_, _, err := util.BuildFilterQuery(filterModel{}, "umur:eq:abc")
+		SendBadRequestResponse(w, err)
+	}))
+
+	router.HandleFunc("/redirect", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SendRedirectResponse(w, errors.New("session not found"))
+	}))
+
+	router.HandleFunc("/conflict", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SendConflictResponse(w, "nrp already exists")
+	}))
+
+	router.HandleFunc("/too-many-requests", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SendTooManyRequestsResponse(w, nil)
+	}))
+
 	router.HandleFunc("/with-meta", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		meta := &Meta{
 			Page:      1,
@@ -78,7 +108,7 @@ func TestHttpResponse(t *testing.T) {
 	// Test on failed to marshal data
 	i, s = test.TestRequest(t, svr, "GET", "/forbidden", nil, nil)
 
-	resForbidden := `{"status":403,"message":"forbidden access","data":null}`
+	resForbidden := `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 
 	require.Equal(t, http.StatusForbidden, i, "Should return 403")
 	require.Equal(t, resForbidden, s, "Should return forbidden access")
@@ -101,20 +131,326 @@ func TestHttpResponse(t *testing.T) {
 	// Test on not found
 	i, s = test.TestRequest(t, svr, "GET", "/not-found", nil, nil)
 
-	resNotFound := `{"status":404,"message":"not found","data":null,"debug":{"error":true,"error_message":"just message"}}`
+	resNotFound := `{"status":404,"message":"not found","code":"not_found","data":null,"debug":{"error":true,"error_message":"just message"}}`
 
 	require.Equal(t, http.StatusNotFound, i, "Should return 404")
 	require.Equal(t, resNotFound, s, "Should return not found")
 
+	// Test on invalid filter
+	i, s = test.TestRequest(t, svr, "GET", "/bad-request", nil, nil)
+
+	resBadRequest := `{"status":400,"message":"bad request","code":"bad_request","data":null,"debug":{"error":true,"error_message":{"fragment":"umur:eq:abc","index":0,"field":"umur","operator":"eq","reason":"error validation: invalid value 'abc' for 'umur'"}}}`
+
+	require.Equal(t, http.StatusBadRequest, i, "Should return 400")
+	require.Equal(t, resBadRequest, s, "Should return bad request")
+
 	// Test on validation
 	i, s = test.TestRequest(t, svr, "GET", "/validation", nil, nil)
 
-	resValidation := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":["Id wajib diisi","Email harus berupa alamat email yang valid"]}}`
+	resValidation := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":["Id wajib diisi","Email harus berupa alamat email yang valid"]}}`
 
 	require.Equal(t, http.StatusForbidden, i, "Should return 403")
 	require.Equal(t, resValidation, s, "Should return `"+resValidation+"`, got `"+s+"`")
 }
 
+func TestHttpResponseError(t *testing.T) {
+	svr := httptest.NewServer(newServer())
+	defer svr.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		envelope string
+		problem  string
+	}{
+		{
+			name:     "redirect",
+			path:     "/redirect",
+			status:   http.StatusPermanentRedirect,
+			envelope: `{"status":308,"message":"permanently_redirect","code":"permanently_redirect","data":null,"debug":{"error":true,"error_message":"session not found"}}`,
+			problem:  `{"type":"about:blank","title":"permanently_redirect","status":308,"detail":"session not found","code":"permanently_redirect"}`,
+		},
+		{
+			name:     "conflict",
+			path:     "/conflict",
+			status:   http.StatusConflict,
+			envelope: `{"status":409,"message":"conflict","code":"conflict","data":null,"debug":{"error":true,"error_message":"nrp already exists"}}`,
+			problem:  `{"type":"about:blank","title":"conflict","status":409,"detail":"nrp already exists","code":"conflict"}`,
+		},
+		{
+			name:     "too many requests",
+			path:     "/too-many-requests",
+			status:   http.StatusTooManyRequests,
+			envelope: `{"status":429,"message":"too many requests","code":"too_many_requests","data":null}`,
+			problem:  `{"type":"about:blank","title":"too many requests","status":429,"code":"too_many_requests"}`,
+		},
+		{
+			name:     "validation",
+			path:     "/validation",
+			status:   http.StatusForbidden,
+			envelope: `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":["Id wajib diisi","Email harus berupa alamat email yang valid"]}}`,
+			problem:  `{"type":"about:blank","title":"forbidden access","status":403,"code":"forbidden","errors":["Id wajib diisi","Email harus berupa alamat email yang valid"]}`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			i, s := test.TestRequest(t, svr, "GET", tt.path, nil, nil)
+			require.Equal(t, tt.status, i)
+			require.Equal(t, tt.envelope, s)
+
+			ProblemJSON = true
+			defer func() { ProblemJSON = false }()
+
+			i, s = test.TestRequest(t, svr, "GET", tt.path, nil, nil)
+			require.Equal(t, tt.status, i)
+			require.Equal(t, tt.problem, s)
+		})
+	}
+}
+
+func TestSendSuccessETag(t *testing.T) {
+	send := func(ifNoneMatch string, opts func(r *http.Request) []SuccessOption) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/wilayah?page=1", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+
+		SendSuccess(w, []string{"Hello", "World"}, nil, nil, opts(r)...)
+		return w
+	}
+
+	// etag from body
+	bodyETag := func(r *http.Request) []SuccessOption {
+		return []SuccessOption{WithETag(r), WithCacheControl(CacheControlReference)}
+	}
+
+	w := send("", bodyETag)
+	etag := w.Header().Get("ETag")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotEmpty(t, etag)
+	require.False(t, strings.HasPrefix(etag, "W/"), "Should be strong etag")
+	require.Equal(t, CacheControlReference, w.Header().Get("Cache-Control"))
+
+	w = send(etag, bodyETag)
+	require.Equal(t, http.StatusNotModified, w.Code)
+	require.Empty(t, w.Body.String())
+	require.Equal(t, etag, w.Header().Get("ETag"))
+	require.Equal(t, CacheControlReference, w.Header().Get("Cache-Control"))
+
+	w = send(`"other", `+etag, bodyETag)
+	require.Equal(t, http.StatusNotModified, w.Code)
+
+	w = send(`"other"`, bodyETag)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// etag from updated at
+	updatedAt, count := time.Now(), int64(3)
+	versionETag := func(r *http.Request) []SuccessOption {
+		return []SuccessOption{WithVersionETag(r, updatedAt, count), WithCacheControl(CacheControlUser)}
+	}
+
+	w = send("", versionETag)
+	etag = w.Header().Get("ETag")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, strings.HasPrefix(etag, "W/"), "Should be weak etag")
+	require.Equal(t, CacheControlUser, w.Header().Get("Cache-Control"))
+
+	w = send(etag, versionETag)
+	require.Equal(t, http.StatusNotModified, w.Code)
+
+	updatedAt = updatedAt.Add(time.Second)
+	w = send(etag, versionETag)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	// a row that isn't the latest one is deleted
+	etag = w.Header().Get("ETag")
+	count--
+	w = send(etag, versionETag)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func TestProto(t *testing.T) {
+	tests := []struct {
+		name     string
+		response HttpResponse
+		expected string
+	}{
+		{
+			name: "with meta",
+			response: HttpResponse{
+				Status:  http.StatusOK,
+				Message: constant.MSG_SUCCESS,
+				Data:    []string{"Hello", "World"},
+				Meta:    &Meta{Page: 2, Limit: 10, TotalPage: 3, TotalData: 25, NextCursor: "next", CountStrategy: "exact"},
+			},
+			expected: `{"status":200,"message":"success","data":["Hello","World"],"meta":{"page":2,"limit":10,"total_page":3,"total_data":25,"next_cursor":"next","count_strategy":"exact"}}`,
+		},
+		{
+			name: "structured debug",
+			response: HttpResponse{
+				Status:  http.StatusBadRequest,
+				Message: constant.MSG_BAD_REQUEST,
+				Debug:   &debug{Error: true, ErrorMessage: []string{"Id wajib diisi"}},
+			},
+			expected: `{"status":400,"message":"bad request","code":"bad_request","data":null,"debug":{"error":true,"error_message":["Id wajib diisi"]}}`,
+		},
+		{
+			name: "string debug",
+			response: HttpResponse{
+				Status:  http.StatusNotFound,
+				Message: constant.MSG_NOT_FOUND,
+				Debug:   &debug{Error: true, ErrorMessage: "just message"},
+			},
+			expected: `{"status":404,"message":"not found","code":"not_found","data":null,"debug":{"error":true,"error_message":"just message"}}`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.response.ToProto()
+			require.NoError(t, err)
+
+			// encode and decode like it's sent through nats
+			b, err := protobuf.Marshal(res)
+			require.NoError(t, err)
+
+			var received proto.Responses
+			require.NoError(t, protobuf.Unmarshal(b, &received))
+
+			w := httptest.NewRecorder()
+			SendProtoResponse(w, &received)
+			require.Equal(t, tt.response.Status, w.Code)
+			require.Equal(t, tt.expected, w.Body.String())
+
+			// and back to proto again
+			again, err := FromProto(&received).ToProto()
+			require.NoError(t, err)
+			require.True(t, protobuf.Equal(res, again))
+		})
+	}
+
+	// plain text debug from old service
+	w := httptest.NewRecorder()
+	SendProtoResponse(w, &proto.Responses{Status: http.StatusForbidden, Message: constant.MSG_FORBIDDEN_ACCESS, Debug: []byte("token expired")})
+	require.Equal(t, `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token expired"}}`, w.Body.String())
+
+	// error reply is sent by the client as is
+	e := ToError(gorm.ErrRecordNotFound).ToProto()
+	require.Equal(t, int32(http.StatusNotFound), e.Status)
+	require.Equal(t, `"record not found"`, string(e.Debug))
+
+	w = httptest.NewRecorder()
+	SendError(w, nil, ErrorFromProto(e))
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Equal(t, `{"status":404,"message":"not found","code":"not_found","data":null,"debug":{"error":true,"error_message":"record not found"}}`, w.Body.String())
+}
+
+type testPgError struct{ code string }
+
+func (e testPgError) Error() string    { return "pg error " + e.code }
+func (e testPgError) SQLState() string { return e.code }
+
+func TestSendError(t *testing.T) {
+	var tv testValidation
+	validationErr := util.ValidateStruct(context.Background(), tv)
+
+	errCustom := errors.New("custom")
+	RegisterError(errCustom, http.StatusTooManyRequests)
+
+	tests := []struct {
+		name     string
+		err      error
+		accept   string
+		status   int
+		expected string
+	}{
+		{
+			name:     "record not found",
+			err:      fmt.Errorf("get user: %w", gorm.ErrRecordNotFound),
+			status:   http.StatusNotFound,
+			expected: `{"status":404,"message":"not found","code":"not_found","data":null,"debug":{"error":true,"error_message":"get user: record not found"}}`,
+		},
+		{
+			name:     "validation",
+			err:      validationErr,
+			status:   http.StatusBadRequest,
+			expected: `{"status":400,"message":"bad request","code":"bad_request","data":null,"debug":{"error":true,"error_message":["Id wajib diisi","Email wajib diisi"]}}`,
+		},
+		{
+			name:     "error struct",
+			err:      &util.ErrorStruct{Status: http.StatusBadRequest, Message: util.ErrValidation.Error(), Err: validationErr},
+			status:   http.StatusBadRequest,
+			expected: `{"status":400,"message":"error validation","code":"bad_request","data":null,"debug":{"error":true,"error_message":["Id wajib diisi","Email wajib diisi"]}}`,
+		},
+		{
+			name:     "sentinel validation",
+			err:      fmt.Errorf("%w: nrp is empty", util.ErrValidation),
+			status:   http.StatusBadRequest,
+			expected: `{"status":400,"message":"bad request","code":"bad_request","data":null,"debug":{"error":true,"error_message":"error validation: nrp is empty"}}`,
+		},
+		{
+			name:     "unique violation",
+			err:      testPgError{"23505"},
+			status:   http.StatusConflict,
+			expected: `{"status":409,"message":"conflict","code":"conflict","data":null,"debug":{"error":true,"error_message":"pg error 23505"}}`,
+		},
+		{
+			name:     "registered",
+			err:      errCustom,
+			status:   http.StatusTooManyRequests,
+			expected: `{"status":429,"message":"too many requests","code":"too_many_requests","data":null,"debug":{"error":true,"error_message":"custom"}}`,
+		},
+		{
+			name:     "typed error",
+			err:      &Error{Status: http.StatusConflict, Code: "nrp_exists", Message: "nrp already exists"},
+			accept:   "application/problem+json",
+			status:   http.StatusConflict,
+			expected: `{"type":"about:blank","title":"nrp already exists","status":409,"code":"nrp_exists"}`,
+		},
+		{
+			name:     "typed error envelope",
+			err:      &Error{Status: http.StatusConflict, Code: "nrp_exists", Message: "nrp already exists"},
+			status:   http.StatusConflict,
+			expected: `{"status":409,"message":"nrp already exists","code":"nrp_exists","data":null}`,
+		},
+		{
+			name:     "typed error wrap registered",
+			err:      &Error{Status: http.StatusConflict, Code: "custom_conflict", Message: "conflict", Detail: errCustom},
+			status:   http.StatusConflict,
+			expected: `{"status":409,"message":"conflict","code":"custom_conflict","data":null,"debug":{"error":true,"error_message":"custom"}}`,
+		},
+		{
+			name:     "error struct without status",
+			err:      &util.ErrorStruct{Message: "x"},
+			status:   http.StatusInternalServerError,
+			expected: `{"status":500,"message":"x","code":"internal_server_error","data":null}`,
+		},
+		{
+			name:     "unknown",
+			err:      errors.New("connection refused"),
+			status:   http.StatusInternalServerError,
+			expected: `{"status":500,"message":"internal server error","code":"internal_server_error","data":null,"debug":{"error":true,"error_message":"connection refused"}}`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+
+			SendError(w, r, tt.err)
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, tt.expected, w.Body.String())
+		})
+	}
+}
+
 func TestHttpResponseProduction(t *testing.T) {
 	svr := httptest.NewServer(newServer())
 	configs.Config.Env = "production"
@@ -135,7 +471,7 @@ func TestHttpResponseProduction(t *testing.T) {
 	// Test on failed to marshal data
 	i, s = test.TestRequest(t, svr, "GET", "/forbidden", nil, nil)
 
-	resForbidden := `{"status":403,"message":"forbidden access","data":null}`
+	resForbidden := `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 
 	require.Equal(t, http.StatusForbidden, i, "Should return 403")
 	require.Equal(t, http.StatusForbidden, i, "Should return 403")
@@ -159,7 +495,7 @@ func TestHttpResponseProduction(t *testing.T) {
 	// Test on not found
 	i, s = test.TestRequest(t, svr, "GET", "/not-found", nil, nil)
 
-	resNotFound := `{"status":404,"message":"not found","data":null}`
+	resNotFound := `{"status":404,"message":"not found","code":"not_found","data":null}`
 
 	require.Equal(t, http.StatusNotFound, i, "Should return 404")
 	require.Equal(t, http.StatusNotFound, i, "Should return 404")
@@ -170,4 +506,63 @@ func TestHttpResponseProduction(t *testing.T) {
 
 	require.Equal(t, http.StatusForbidden, i, "Should return 403")
 	require.Equal(t, resForbidden, s, "Should return forbidden")
+
+	// Test on SendError
+	w := httptest.NewRecorder()
+	SendError(w, httptest.NewRequest(http.MethodGet, "/", nil), errors.New("connection refused"))
+
+	require.Equal(t, http.StatusInternalServerError, w.Code, "Should return 500")
+	require.Equal(t, `{"status":500,"message":"internal server error","code":"internal_server_error","data":null}`, w.Body.String(), "Should hide debug")
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", ContentTypeJSON},
+		{"*/*", ContentTypeJSON},
+		{"text/csv", ContentTypeCSV},
+		{"application/ndjson", ContentTypeNDJSON},
+		{"text/csv;q=0.1, application/json", ContentTypeJSON},
+		{"application/json;q=0.5, application/x-ndjson;q=0.9", ContentTypeNDJSON},
+		{"text/csv, application/x-ndjson", ContentTypeCSV},
+		{"text/csv;q=0, application/x-ndjson;q=0.2", ContentTypeNDJSON},
+		{"text/csv;q=0", ContentTypeJSON},
+		{"text/csv;q=abc, application/x-ndjson;q=0.1", ContentTypeNDJSON},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.accept, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			require.Equal(t, tt.expected, Negotiate(r))
+		})
+	}
+}
+
+func TestCSVColumns(t *testing.T) {
+	type base struct {
+		ID        uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	type wilayah struct {
+		base
+		ParentID    *string    `json:"parent_id"`
+		Parent      *wilayah   `json:"parent,omitempty"`
+		Nama        string     `json:"nama"`
+		Active      *bool      `json:"active"`
+		Kode        int        `json:"kode,string"`
+		Kepolisians []*wilayah `json:"kepolisians,omitempty"`
+		Tags        []string   `json:"tags"`
+		Extra       map[string]any
+		Secret      string `json:"-"`
+		hidden      string
+	}
+
+	var names []string
+	for _, c := range csvColumns(reflect.TypeOf(wilayah{})) {
+		names = append(names, c.name)
+	}
+	require.Equal(t, []string{"id", "created_at", "parent_id", "nama", "active", "kode"}, names)
 }
@@ -0,0 +1,145 @@
+package http_response
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dzrock1989/perkakas/configs"
+	"github.com/dzrock1989/perkakas/proto"
+)
+
+// ToProto convert the response into proto.Responses,
+// data and debug message are encoded as json
+func (r HttpResponse) ToProto() (*proto.Responses, error) {
+	res := &proto.Responses{
+		Status:  int32(r.Status),
+		Message: r.Message,
+		Meta:    r.Meta.ToProto(),
+	}
+
+	var err error
+	if r.Data != nil {
+		if res.Data, err = json.Marshal(r.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.Debug != nil {
+		if res.Debug, err = json.Marshal(r.Debug.ErrorMessage); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// FromProto convert proto.Responses into response,
+// data and debug message are kept as raw json so it's not encoded twice.
+// code of error response is the default code of the status
+func FromProto(res *proto.Responses) HttpResponse {
+	return HttpResponse{
+		Status:  int(res.GetStatus()),
+		Message: res.GetMessage(),
+		Code:    statusErrors[int(res.GetStatus())].Code,
+		Data:    rawData(res.GetData()),
+		Meta:    MetaFromProto(res.GetMeta()),
+		Debug:   debugFromBytes(res.GetDebug()),
+	}
+}
+
+func (m *Meta) ToProto() *proto.ResponseMeta {
+	if m == nil {
+		return nil
+	}
+
+	return &proto.ResponseMeta{
+		Page:          int32(m.Page),
+		Limit:         int32(m.Limit),
+		TotalData:     int64(m.TotalData),
+		TotalPage:     int64(m.TotalPage),
+		NextCursor:    m.NextCursor,
+		PrevCursor:    m.PrevCursor,
+		CountStrategy: m.CountStrategy,
+	}
+}
+
+func MetaFromProto(meta *proto.ResponseMeta) *Meta {
+	if meta == nil {
+		return nil
+	}
+
+	return &Meta{
+		Page:          int(meta.GetPage()),
+		Limit:         int(meta.GetLimit()),
+		TotalPage:     int(meta.GetTotalPage()),
+		TotalData:     int(meta.GetTotalData()),
+		NextCursor:    meta.GetNextCursor(),
+		PrevCursor:    meta.GetPrevCursor(),
+		CountStrategy: meta.GetCountStrategy(),
+	}
+}
+
+// SendProtoResponse forward reply of nats (or other rpc) to client,
+// status code of the reply is used as http status code
+func SendProtoResponse(w http.ResponseWriter, res *proto.Responses) {
+	status := int(res.GetStatus())
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	response := FromProto(res)
+	response.Status = status
+	writeJSON(w, "application/json; charset=utf-8", status, response)
+}
+
+func rawData(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return json.RawMessage(data)
+}
+
+// debugFromBytes use the debug as json when it's valid json, otherwise as string.
+// debug is hidden on production
+func debugFromBytes(b []byte) *debug {
+	if len(b) == 0 || configs.Config.IsProduction() {
+		return nil
+	}
+
+	if json.Valid(b) {
+		return &debug{Error: true, ErrorMessage: json.RawMessage(b)}
+	}
+
+	return &debug{Error: true, ErrorMessage: string(b)}
+}
+
+// ToProto convert the error into proto.Responses for rpc reply,
+// detail is encoded as debug and hidden on production
+func (e *Error) ToProto() *proto.Responses {
+	res := &proto.Responses{
+		Status:  int32(e.Status),
+		Message: e.Message,
+	}
+
+	if d := validateErrorMessage(e.Detail); d != nil {
+		if b, err := json.Marshal(d.ErrorMessage); err == nil {
+			res.Debug = b
+		}
+	}
+
+	return res
+}
+
+// ErrorFromProto convert non 2xx proto.Responses into Error,
+// so the caller can render it with SendError as is
+func ErrorFromProto(res *proto.Responses) *Error {
+	e := NewError(int(res.GetStatus()), nil)
+	e.Message = res.GetMessage()
+
+	if d := debugFromBytes(res.GetDebug()); d != nil {
+		e.Detail = d.ErrorMessage
+	}
+
+	return e
+}
@@ -0,0 +1,302 @@
+package http_response
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dzrock1989/perkakas/common/constant"
+	"github.com/dzrock1989/perkakas/common/util"
+	"gorm.io/gorm"
+)
+
+const (
+	ContentTypeJSON   = "application/json"
+	ContentTypeCSV    = "text/csv"
+	ContentTypeNDJSON = "application/x-ndjson"
+)
+
+// rows are flushed to client every flushEvery rows
+const flushEvery = 100
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+var negotiable = map[string]string{
+	ContentTypeJSON:      ContentTypeJSON,
+	ContentTypeCSV:       ContentTypeCSV,
+	ContentTypeNDJSON:    ContentTypeNDJSON,
+	"application/ndjson": ContentTypeNDJSON,
+}
+
+// Negotiate return content type for list response from Accept header,
+// the type with the highest q value is chosen and q=0 is not acceptable.
+// ContentTypeJSON is returned when client doesn't accept csv or ndjson
+func Negotiate(r *http.Request) string {
+	best, bestQ := ContentTypeJSON, 0.0
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+
+		contentType, ok := negotiable[mediaType]
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		// the first listed type win on the same q
+		if q > bestQ {
+			best, bestQ = contentType, q
+		}
+	}
+
+	return best
+}
+
+// SendRows stream rows as json, csv or ndjson based on Accept header,
+// each row is scanned into T with db.ScanRows so only one row is kept in memory.
+// csv columns are taken from json tag of T.
+// error in the middle of the stream can't change the status code, it's only logged
+func SendRows[T any](w http.ResponseWriter, r *http.Request, db *gorm.DB, rows *sql.Rows) {
+	var err error
+	switch Negotiate(r) {
+	case ContentTypeCSV:
+		err = streamCSV[T](w, db, rows)
+	case ContentTypeNDJSON:
+		err = streamNDJSON[T](w, db, rows)
+	default:
+		err = streamJSON[T](w, db, rows)
+	}
+
+	if err != nil {
+		util.Log.Error().Msg(err.Error())
+	}
+}
+
+// eachRow scan every row into T and call fn, the writer is flushed periodically
+func eachRow[T any](w http.ResponseWriter, db *gorm.DB, rows *sql.Rows, flush func() error, fn func(i int, row *T) error) error {
+	flusher, _ := w.(http.Flusher)
+
+	for i := 0; rows.Next(); i++ {
+		var row T
+		if err := db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+
+		if err := fn(i, &row); err != nil {
+			return err
+		}
+
+		if (i+1)%flushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+func streamJSON[T any](w http.ResponseWriter, db *gorm.DB, rows *sql.Rows) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `{"status":%d,"message":%q,"data":[`, http.StatusOK, constant.MSG_SUCCESS)
+
+	err := eachRow(w, db, rows, bw.Flush, func(i int, row *T) error {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+
+		b, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		_, err = bw.Write(b)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	bw.WriteString("]}")
+
+	return bw.Flush()
+}
+
+func streamNDJSON[T any](w http.ResponseWriter, db *gorm.DB, rows *sql.Rows) error {
+	w.Header().Set("Content-Type", ContentTypeNDJSON)
+	w.WriteHeader(http.StatusOK)
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	return eachRow(w, db, rows, bw.Flush, func(_ int, row *T) error {
+		return enc.Encode(row)
+	})
+}
+
+func streamCSV[T any](w http.ResponseWriter, db *gorm.DB, rows *sql.Rows) error {
+	columns := csvColumns(reflect.TypeOf((*T)(nil)).Elem())
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	header := make([]string, 0, len(columns))
+	for _, c := range columns {
+		header = append(header, c.name)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	flush := func() error {
+		cw.Flush()
+		return cw.Error()
+	}
+
+	record := make([]string, len(columns))
+	return eachRow(w, db, rows, flush, func(_ int, row *T) error {
+		v := reflect.ValueOf(row).Elem()
+		for i, c := range columns {
+			record[i] = csvValue(v.FieldByIndex(c.index))
+		}
+
+		return cw.Write(record)
+	})
+}
+
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+// csvColumns return exported scalar fields of struct with its json name,
+// fields of embedded struct are included and field with json tag "-" or relation (ex: Parent, Kepolisians) is skipped
+func csvColumns(t reflect.Type) []csvColumn {
+	var columns []csvColumn
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return columns
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			for _, c := range csvColumns(f.Type) {
+				c.index = append([]int{i}, c.index...)
+				columns = append(columns, c)
+			}
+			continue
+		}
+
+		if !f.IsExported() || !csvScalar(f.Type) {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+
+		columns = append(columns, csvColumn{name: name, index: []int{i}})
+	}
+
+	return columns
+}
+
+// csvScalar check the value of t fits in a cell, struct, slice and map is only scalar when it's a TextMarshaler (ex: time.Time, uuid.UUID)
+func csvScalar(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Implements(textMarshalerType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return false
+	}
+
+	return true
+}
+
+func csvValue(v reflect.Value) string {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err == nil {
+			return string(b)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return escapeFormula(v.String())
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(v.Interface())
+	}
+
+	b, _ := json.Marshal(v.Interface())
+
+	return string(b)
+}
+
+// escapeFormula prevent spreadsheet from executing value as formula (csv injection)
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+
+	return s
+}
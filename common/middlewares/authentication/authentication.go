@@ -2,198 +2,140 @@ package authentication
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
-	"time"
 
 	"github.com/tigapilarmandiri/perkakas/common/http_response"
+	"github.com/tigapilarmandiri/perkakas/common/middlewares/authenticator"
 	"github.com/tigapilarmandiri/perkakas/common/middlewares/authorization"
 	"github.com/tigapilarmandiri/perkakas/common/middlewares/impersonate"
 	"github.com/tigapilarmandiri/perkakas/common/sessions"
 	"github.com/tigapilarmandiri/perkakas/common/util"
 	"github.com/tigapilarmandiri/perkakas/configs"
-
-	"github.com/golang-jwt/jwt/v4"
 )
 
 var (
-	errDateOrTokenEmpty = errors.New("token or date is empty")
+	errDateOrTokenEmpty = authenticator.ErrDateOrTokenEmpty
+
+	errTokenNotValid = authenticator.ErrTokenNotValid
 
-	errTokenNotValid = errors.New("token not valid")
+	errDateNotValid   = authenticator.ErrDateNotValid
+	errDateIsNotEpoch = authenticator.ErrDateIsNotEpoch
+	errDateExpired    = authenticator.ErrDateExpired
+	errHmacNotValid   = authenticator.ErrHmacNotValid
 
-	errDateNotValid   = errors.New("date not valid")
-	errDateIsNotEpoch = errors.New("date is not epoch")
-	errDateExpired    = errors.New("date is expired")
-	errHmacNotValid   = errors.New("hmac not valid")
+	errGetSession          = errors.New("failed to get session")
+	errImpersonateNotFound = errors.New("impersonate token not found or expired")
 )
 
+// Authenticator of the internal user, the keys is configs.Config.JWT.DateKey and SecretKey,
+// or JWKS to verify asymmetric jwt.
+// request signed with nonce is protected from replay, see authenticator.Replay
+var Authenticator = &authenticator.Authenticator[authorization.Claims]{
+	Keys: authenticator.Keys(func() (string, string, string) {
+		return configs.Config.JWT.DateKey, configs.Config.JWT.SecretKey, configs.Config.JWT.JWKS
+	}),
+	Session:       validateSession,
+	Impersonation: validateImpersonation,
+	Replay:        &authenticator.Replay{},
+}
+
 // Authentication is for validate the user
 // if you want to protect it with JWT set isThereAJwt to true
 // if no, set isThereAJwt to false
 func Authentication(isThereAJwt bool) func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authToken := r.Header.Get("Authorization")
-			date := r.Header.Get("Dates")
-
-			if isAuthorizationOrDateEmpty(authToken, date) {
-				util.Log.Error().Msg(errDateOrTokenEmpty.Error())
-				http_response.SendForbiddenResponse(w, errDateOrTokenEmpty)
-				return
-			}
-
-			hmac_jwtToken, err := getHmacDate_JwtToken(authToken)
-			if err != nil {
-				util.Log.Error().Msg(err.Error())
-				http_response.SendForbiddenResponse(w, err)
-				return
-			}
-
-			authToken, err = validateDate(date, hmac_jwtToken)
-			if err != nil {
-				util.Log.Error().Msg(err.Error())
-				http_response.SendForbiddenResponse(w, err)
-				return
-			}
-
-			if !isThereAJwt {
-				next.ServeHTTP(w, r)
-				return
-			}
-
-			token, err := jwt.Parse(authToken, func(token *jwt.Token) (any, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method :%v", token.Header["alg"])
-				}
-
-				return []byte(configs.Config.JWT.SecretKey), nil
-			})
-			if err != nil {
-				util.Log.Error().Msg(err.Error())
-				// sometimes it will error token is expired
-				http_response.SendForbiddenResponse(w, err)
-				return
-			}
-
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok || !token.Valid {
-				http_response.SendForbiddenResponse(w, errTokenNotValid)
-				return
-			}
-			b, err := json.Marshal(claims)
-			if err != nil {
-				util.Log.Error().Msg(err.Error())
-				http_response.SendForbiddenResponse(w, nil)
-				return
-			}
-			ctx := context.WithValue(r.Context(), util.ContextKey(util.ContextClaimsBytes), b)
-
-			var userInfo authorization.Claims
-
-			err = json.Unmarshal(b, &userInfo)
-			if err != nil {
-				util.Log.Error().Msg(err.Error())
-				http_response.SendForbiddenResponse(w, nil)
-				return
-			}
-
-			if configs.Config.Env == "local" {
-				ctx = context.WithValue(ctx, util.ContextKey(util.ContextClaims), userInfo)
-				r = r.WithContext(ctx)
-
-				next.ServeHTTP(w, r)
-				return
-			}
-
-			// Check the sessions
-			ok, err = sessions.IsExist(r.Context(), userInfo.UserUUID)
-			if err != nil {
-				util.Log.Error().Msg(err.Error())
-				http_response.SendForbiddenResponse(w, errors.New("failed to get session"))
-				return
-			}
-
-			if !ok && !userInfo.Impersonate {
-				http_response.SendRedirectResponse(w, errors.New("session not found"))
-				return
-			}
-
-			if userInfo.Impersonate {
-				if ok := impersonate.IsExist(userInfo.UserName); !ok {
-					err = errors.New("impersonate token not found or expired")
-
-					util.Log.Error().Msg(err.Error())
-					http_response.SendForbiddenResponse(w, err)
-					return
-				}
-			}
-
-			ctx = context.WithValue(ctx, util.ContextKey(util.ContextClaims), userInfo)
-			r = r.WithContext(ctx)
-
-			next.ServeHTTP(w, r)
-		})
-	}
+	return Authenticator.Middleware(isThereAJwt)
 }
 
-func isAuthorizationOrDateEmpty(authorization, date string) bool {
-	return authorization == "" || date == ""
-}
+// Credential is authorization of rpc request,
+// it's the Authorization, Dates and the nonce signature of http request
+type Credential = authenticator.Credential
 
-func getHmacDate_JwtToken(token string) (string, error) {
-	arrToken := strings.Split(token, "Bearer ")
-	if len(arrToken) != 2 {
-		return "", errTokenNotValid
-	}
-
-	return arrToken[1], nil
+// CredentialFromRequest encode Authorization, Dates and the nonce signature of r
+// to be forwarded as proto.Requests.Authorization
+func CredentialFromRequest(r *http.Request) []byte {
+	return authenticator.CredentialFromRequest(r)
 }
 
-func validateDate(date, hmac_jwtToken string) (string, error) {
-	arrToken := strings.SplitN(hmac_jwtToken, "_", 2)
+// ForwardRPC sign the credential of CredentialFromRequest again for the rpc call of uri with body,
+// ex: the subject or the full method of grpc and the data of proto.Requests
+func ForwardRPC(authorization []byte, uri string, body []byte) []byte {
+	return Authenticator.ForwardRPC(authorization, uri, body)
+}
 
-	if len(arrToken) != 2 {
-		return "", errDateNotValid
-	}
+// AuthenticateRPC is Authenticate for proto.Requests.Authorization of the rpc call of uri with body
+// that is encoded by CredentialFromRequest and signed with ForwardRPC
+func AuthenticateRPC(ctx context.Context, authorization []byte, uri string, body []byte, isThereAJwt bool) (context.Context, error) {
+	return Authenticator.AuthenticateRPC(ctx, authorization, uri, body, isThereAJwt)
+}
 
-	// get hmac from header date
-	sig := hmac.New(sha256.New, []byte(configs.Config.JWT.DateKey))
-	sig.Write([]byte(date))
+// Authenticate validate hmac of the date, jwt and session of the user,
+// the claims is added to ctx under util.ContextClaims.
+// the error is *http_response.Error, redirect when the session is not found and forbidden for others
+func Authenticate(ctx context.Context, authToken, date string, isThereAJwt bool) (context.Context, error) {
+	return Authenticator.Authenticate(ctx, authToken, date, isThereAJwt)
+}
 
-	hmac_date := hex.EncodeToString(sig.Sum(nil))
+// AuthenticateCall is Authenticate of credential of the rpc call of uri with body,
+// ex: credential from grpc metadata
+func AuthenticateCall(ctx context.Context, cred Credential, uri string, body []byte, isThereAJwt bool) (context.Context, error) {
+	return Authenticator.AuthenticateCall(ctx, cred, uri, body, isThereAJwt)
+}
 
-	// compare hmac and authentication
-	if hmac_date != arrToken[0] {
-		return "", errHmacNotValid
+// validateSession check the token is the active token of the user session,
+// the client is compared based on configs.Config.Session.ClientCheck
+func validateSession(ctx context.Context, claims authorization.Claims, client authenticator.Client) (context.Context, error) {
+	if configs.Config.Env == "local" {
+		return ctx, nil
 	}
 
-	dif := time.Hour * 24 * 7 // 7 days
-	if configs.Config.IsProduction() {
-		dif = time.Hour * 5
+	session, changed, err := sessions.Validate(ctx, claims.UserUUID, client.Token, client.RemoteAddr, client.UserAgent)
+	if err == nil {
+		session, err = sessions.Touch(ctx, session)
 	}
 
-	epoch, err := strconv.Atoi(date)
-	if err != nil {
+	switch {
+	case errors.Is(err, sessions.ErrSessionNotFound), errors.Is(err, sessions.ErrTokenNotActive):
+		// the user must login again
+		return ctx, http_response.NewError(http.StatusPermanentRedirect, err)
+	case errors.Is(err, sessions.ErrClientChanged):
+		util.Log.Warn().Str("user_uuid", claims.UserUUID).Msg(err.Error())
+		return ctx, http_response.NewError(http.StatusForbidden, err)
+	case err != nil:
 		util.Log.Error().Msg(err.Error())
-		return "", errDateIsNotEpoch
+		return ctx, http_response.NewError(http.StatusForbidden, errGetSession)
+	}
+
+	ctx = context.WithValue(ctx, util.ContextKey(util.ContextSessionID), session.ID)
+
+	if len(changed) > 0 {
+		util.Log.Warn().Str("user_uuid", claims.UserUUID).Strs("changed", changed).Msg(sessions.ErrClientChanged.Error())
+		ctx = context.WithValue(ctx, util.ContextKey(util.ContextSessionChanged), changed)
 	}
 
-	epochTime := time.UnixMilli(int64(epoch))
-	since := time.Since(epochTime)
-	if since < 0 {
-		since *= -1
+	return ctx, nil
+}
+
+func validateImpersonation(ctx context.Context, claims authorization.Claims) (bool, error) {
+	if configs.Config.Env == "local" || !claims.Impersonate {
+		return false, nil
 	}
 
-	if since > dif {
-		return "", errDateExpired
+	if !impersonate.IsExist(claims.UserName) {
+		return false, errImpersonateNotFound
 	}
 
-	return arrToken[1], nil
+	return true, nil
+}
+
+func isAuthorizationOrDateEmpty(authorization, date string) bool {
+	return authenticator.IsAuthorizationOrDateEmpty(authorization, date)
+}
+
+func getHmacDate_JwtToken(token string) (string, error) {
+	return authenticator.GetHmacDate_JwtToken(token)
+}
+
+func validateDate(date, hmac_jwtToken string) (string, error) {
+	return Authenticator.ValidateDate(date, hmac_jwtToken)
 }
@@ -1,9 +1,11 @@
 package authentication
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +13,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/tigapilarmandiri/perkakas/common/http_response"
+	"github.com/tigapilarmandiri/perkakas/common/middlewares/authorization"
 	"github.com/tigapilarmandiri/perkakas/common/test"
 	"github.com/tigapilarmandiri/perkakas/configs"
 
@@ -153,7 +157,7 @@ func TestNoJwt(t *testing.T) {
 	defer ts.Close()
 
 	// sending empty date
-	respEmptyToken := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
+	respEmptyToken := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
 
 	if status, resp := test.TestRequest(t, ts, "GET", "/", nil, nil); status != http.StatusForbidden || resp != respEmptyToken {
 		t.Fatalf(resp)
@@ -169,7 +173,7 @@ func TestNoJwt(t *testing.T) {
 	h := make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"date is expired"}}`
+	respReq := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"date is expired"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -206,7 +210,7 @@ func TestAuthentication(t *testing.T) {
 	defer ts.Close()
 
 	// sending empty token and date
-	respEmptyToken := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
+	respEmptyToken := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
 
 	if status, resp := test.TestRequest(t, ts, "GET", "/", nil, nil); status != http.StatusForbidden || resp != respEmptyToken {
 		t.Fatalf(resp)
@@ -220,21 +224,21 @@ func TestAuthentication(t *testing.T) {
 		t.Fatal(err)
 	}
 	h.Set("Authorization", token)
-	respWrongKey := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
+	respWrongKey := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respWrongKey {
 		t.Fatalf(resp)
 	}
 
 	// sending wrong jwt token and empty date
 	h.Set("Authorization", "asdf")
-	respWrongJWT := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
+	respWrongJWT := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respWrongJWT {
 		t.Fatalf(resp)
 	}
 
 	// sending expired token and empty date
 	jwtToken = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": time.Now().Add(-30 * time.Second).Unix()})
-	respTokenExpired := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
+	respTokenExpired := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
 	token, err = jwtToken.SignedString([]byte(key))
 	if err != nil {
 		t.Fatal(err)
@@ -266,7 +270,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", token)
 	h.Set("Dates", strconv.Itoa(int(time.Now().UnixMilli())))
-	respReq := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token not valid"}}`
+	respReq := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token not valid"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -281,7 +285,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"date is expired"}}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"date is expired"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -296,7 +300,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"date not valid"}}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"date not valid"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -311,7 +315,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"date is not epoch"}}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"date is not epoch"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -326,7 +330,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message+"a")
-	respReq = `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"hmac not valid"}}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"hmac not valid"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -347,7 +351,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message2)
-	respReq = `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"hmac not valid"}}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"hmac not valid"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -362,7 +366,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token contains an invalid number of segments"}}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token contains an invalid number of segments"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -400,7 +404,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	defer ts.Close()
 
 	// sending empty token and date
-	respEmptyToken := `{"status":403,"message":"forbidden access","data":null}`
+	respEmptyToken := `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 
 	if status, resp := test.TestRequest(t, ts, "GET", "/", nil, nil); status != http.StatusForbidden || resp != respEmptyToken {
 		t.Fatalf(resp)
@@ -414,21 +418,21 @@ func TestAuthenticationProduction(t *testing.T) {
 		t.Fatal(err)
 	}
 	h.Set("Authorization", token)
-	respWrongKey := `{"status":403,"message":"forbidden access","data":null}`
+	respWrongKey := `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respWrongKey {
 		t.Fatalf(resp)
 	}
 
 	// sending wrong jwt token and empty date
 	h.Set("Authorization", "asdf")
-	respWrongJWT := `{"status":403,"message":"forbidden access","data":null}`
+	respWrongJWT := `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respWrongJWT {
 		t.Fatalf(resp)
 	}
 
 	// sending expired token and empty date
 	jwtToken = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": time.Now().Add(-30 * time.Second).Unix()})
-	respTokenExpired := `{"status":403,"message":"forbidden access","data":null}`
+	respTokenExpired := `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	token, err = jwtToken.SignedString([]byte(key))
 	if err != nil {
 		t.Fatal(err)
@@ -460,7 +464,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", token)
 	h.Set("Dates", strconv.Itoa(int(time.Now().UnixMilli())))
-	respReq := `{"status":403,"message":"forbidden access","data":null}`
+	respReq := `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -475,7 +479,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -490,7 +494,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -505,7 +509,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -520,7 +524,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message+"a")
-	respReq = `{"status":403,"message":"forbidden access","data":null}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -541,7 +545,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message2)
-	respReq = `{"status":403,"message":"forbidden access","data":null}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -556,7 +560,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -575,3 +579,59 @@ func TestAuthenticationProduction(t *testing.T) {
 		t.Fatalf(resp)
 	}
 }
+
+func TestAuthenticateRPC(t *testing.T) {
+	key := "secretKey"
+	jwtConfig, env := configs.Config.JWT, configs.Config.Env
+	t.Cleanup(func() { configs.Config.JWT, configs.Config.Env = jwtConfig, env })
+
+	configs.Config.JWT.SecretKey = key
+	configs.Config.JWT.DateKey = key
+	configs.Config.Env = "local"
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_uuid": "uuid-1"}).SignedString([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := strconv.Itoa(int(time.Now().UnixMilli()))
+	sig := hmac.New(sha256.New, []byte(key))
+	sig.Write([]byte(message))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+hex.EncodeToString(sig.Sum(nil))+"_"+token)
+	r.Header.Set("Dates", message)
+
+	// credential is forwarded by the gateway
+	ctx, err := AuthenticateRPC(context.Background(), CredentialFromRequest(r), "users.get", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, ok := authorization.ClaimsFromContext(ctx)
+	if !ok || claims.UserUUID != "uuid-1" {
+		t.Fatalf("claims not found: %+v", claims)
+	}
+
+	tests := []struct {
+		name          string
+		authorization []byte
+		expected      error
+	}{
+		{"empty", nil, errDateOrTokenEmpty},
+		{"not json", []byte("Bearer asdf"), errTokenNotValid},
+		{"empty date", []byte(`{"authorization":"Bearer asdf"}`), errDateOrTokenEmpty},
+		{"hmac not valid", []byte(`{"authorization":"Bearer asdf_` + token + `","dates":"` + message + `"}`), errHmacNotValid},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := AuthenticateRPC(context.Background(), tt.authorization, "users.get", nil, true)
+
+			var e *http_response.Error
+			if !errors.As(err, &e) || e.Status != http.StatusForbidden || !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, actual %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Package authenticationtest set up authentication.Authenticator and sign the credential
+// for test of the handler that is protected by authentication, ex: natsrpc and grpc_server
+package authenticationtest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/tigapilarmandiri/perkakas/common/middlewares/authentication"
+	"github.com/tigapilarmandiri/perkakas/common/middlewares/authenticator"
+	"github.com/tigapilarmandiri/perkakas/common/rds/rdstest"
+	"github.com/tigapilarmandiri/perkakas/configs"
+)
+
+// Key is the jwt and date key of Setup
+const Key = "secretKey"
+
+// UserUUID is user_uuid claim of Token
+const UserUUID = "uuid-1"
+
+// Setup use Key as configs.Config.JWT.SecretKey and DateKey on local env, so the session is not checked.
+// the config is restored on cleanup
+func Setup(t *testing.T) {
+	jwtConfig, env := configs.Config.JWT, configs.Config.Env
+	configs.Config.JWT.SecretKey, configs.Config.JWT.DateKey, configs.Config.JWT.JWKS = Key, Key, ""
+	configs.Config.Env = "local"
+	t.Cleanup(func() { configs.Config.JWT, configs.Config.Env = jwtConfig, env })
+}
+
+// RequireSignature refuse the legacy signature of authentication.Authenticator,
+// the used nonce is stored in the returned redis. the replay is restored on cleanup
+func RequireSignature(t *testing.T) *rdstest.Redis {
+	nonces := rdstest.New()
+
+	replay := *authentication.Authenticator.Replay
+	authentication.Authenticator.Replay.Nonces = nonces
+	authentication.Authenticator.Replay.Required = true
+	t.Cleanup(func() { *authentication.Authenticator.Replay = replay })
+
+	return nonces
+}
+
+// Token return jwt of UserUUID that is signed with Key
+func Token(t *testing.T) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_uuid": UserUUID}).SignedString([]byte(Key))
+	require.NoError(t, err)
+
+	return token
+}
+
+// Date return the Dates header of now
+func Date() string {
+	return strconv.FormatInt(time.Now().UnixMilli(), 10)
+}
+
+// Legacy return the Authorization header of the legacy signature of the date only
+func Legacy(t *testing.T, date string) string {
+	sig := hmac.New(sha256.New, []byte(Key))
+	sig.Write([]byte(date))
+
+	return "Bearer " + hex.EncodeToString(sig.Sum(nil)) + "_" + Token(t)
+}
+
+// Signed return the Authorization header of the nonce signature of the request, see authenticator.Sign
+func Signed(t *testing.T, method, uri, date, nonce string, body []byte) string {
+	return "Bearer " + authenticator.Sign([]byte(Key), method, uri, date, nonce, body) + "_" + Token(t)
+}
+
+// Request return http request of now that is signed with the nonce, empty nonce use the legacy signature
+func Request(t *testing.T, method, uri, body, nonce string) *http.Request {
+	date := Date()
+
+	r := httptest.NewRequest(method, uri, strings.NewReader(body))
+	r.Header.Set("Dates", date)
+	if nonce == "" {
+		r.Header.Set("Authorization", Legacy(t, date))
+		return r
+	}
+
+	r.Header.Set("Authorization", Signed(t, method, uri, date, nonce, []byte(body)))
+	r.Header.Set(authenticator.HeaderNonce, nonce)
+
+	return r
+}
@@ -0,0 +1,319 @@
+package authenticator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tigapilarmandiri/perkakas/common/http_response"
+	"github.com/tigapilarmandiri/perkakas/common/util"
+	"github.com/tigapilarmandiri/perkakas/configs"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrDateOrTokenEmpty = errors.New("token or date is empty")
+
+	ErrTokenNotValid = errors.New("token not valid")
+
+	ErrDateNotValid   = errors.New("date not valid")
+	ErrDateIsNotEpoch = errors.New("date is not epoch")
+	ErrDateExpired    = errors.New("date is expired")
+	ErrHmacNotValid   = errors.New("hmac not valid")
+)
+
+// DefaultSkew is the max difference between the date of the request and now,
+// 5 hours on production and 7 days on others
+func DefaultSkew() time.Duration {
+	if configs.Config.IsProduction() {
+		return time.Hour * 5
+	}
+
+	return time.Hour * 24 * 7
+}
+
+// Authenticator validate the Authorization and Dates header of a user population,
+// T is the claims of the jwt, ex: authorization.Claims.
+// the header is "Bearer <hmac of the date>_<jwt>"
+type Authenticator[T any] struct {
+	// Keys return the key of the date hmac and the jwt
+	Keys KeyProvider
+
+	// Skew is the max difference between the date and now, zero use DefaultSkew
+	Skew time.Duration
+
+	// Session validate session of the user, nil skip the check. the returned ctx is passed to the handler.
+	// return *http_response.Error to choose the status, other error is forbidden
+	Session func(ctx context.Context, claims T, client Client) (context.Context, error)
+
+	// Impersonation return true when the claims is an impersonation and it's still valid,
+	// the session is not checked for impersonation. nil means no impersonation
+	Impersonation func(ctx context.Context, claims T) (bool, error)
+
+	// Replay enable the request signature with nonce of AuthenticateRequest, nil accept the legacy signature only
+	Replay *Replay
+
+	// Now is used to validate the date, default is time.Now
+	Now func() time.Time
+}
+
+// Middleware is http middleware of AuthenticateRequest,
+// if you want to protect it with JWT set isThereAJwt to true
+// if no, set isThereAJwt to false
+func (a *Authenticator[T]) Middleware(isThereAJwt bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := a.AuthenticateRequest(r, isThereAJwt)
+			if err != nil {
+				http_response.SendError(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Client is the jwt and client of the request that is passed to Session,
+// RemoteAddr and UserAgent is empty when it's authenticated with Authenticate, ex: rpc request
+type Client struct {
+	Token      string
+	RemoteAddr string
+	UserAgent  string
+}
+
+// Credential is authorization of rpc request, it's the Authorization, Dates and Nonce header of http request.
+// Method, URI and BodyHash is the request that is signed with the nonce, see Sign.
+// the rpc server verify the signature of its call instead, see AuthenticateCall and Forward
+type Credential struct {
+	Authorization string `json:"authorization"`
+	Dates         string `json:"dates"`
+	Nonce         string `json:"nonce,omitempty"`
+	Method        string `json:"method,omitempty"`
+	URI           string `json:"uri,omitempty"`
+	// BodyHash is hex of sha256 of the body, see HashBody
+	BodyHash string `json:"body_hash,omitempty"`
+}
+
+// CredentialFromRequest encode Authorization, Dates and the signed request of r
+// to be forwarded as proto.Requests.Authorization
+func CredentialFromRequest(r *http.Request) []byte {
+	cred, err := credentialFromRequest(r, (*Replay)(nil).maxBodySize())
+	if err != nil {
+		// the signature can't be verified without the body hash
+		util.Log.Error().Msg(err.Error())
+	}
+
+	b, _ := json.Marshal(cred)
+
+	return b
+}
+
+// ForwardRPC is Forward of proto.Requests.Authorization that is encoded by CredentialFromRequest,
+// authorization that can't be signed is logged and returned as is
+func (a *Authenticator[T]) ForwardRPC(authorization []byte, uri string, body []byte) []byte {
+	var cred Credential
+	if err := json.Unmarshal(authorization, &cred); err != nil {
+		return authorization
+	}
+
+	cred, err := a.Forward(cred, uri, body)
+	if err != nil {
+		util.Log.Error().Msg(err.Error())
+		return authorization
+	}
+
+	b, _ := json.Marshal(cred)
+
+	return b
+}
+
+// AuthenticateRPC is AuthenticateCall for proto.Requests.Authorization
+// that is encoded by CredentialFromRequest and signed for the call with ForwardRPC
+func (a *Authenticator[T]) AuthenticateRPC(ctx context.Context, authorization []byte, uri string, body []byte, isThereAJwt bool) (context.Context, error) {
+	var cred Credential
+	if len(authorization) > 0 {
+		if err := json.Unmarshal(authorization, &cred); err != nil {
+			util.Log.Error().Msg(err.Error())
+			return ctx, http_response.NewError(http.StatusForbidden, ErrTokenNotValid)
+		}
+	}
+
+	return a.AuthenticateCall(ctx, cred, uri, body, isThereAJwt)
+}
+
+// Authenticate validate hmac of the date, jwt, impersonation and session of the user,
+// the claims is added to ctx under util.ContextClaims as T and util.ContextClaimsBytes as json.
+// the error is *http_response.Error, forbidden unless Session choose the status
+func (a *Authenticator[T]) Authenticate(ctx context.Context, authToken, date string, isThereAJwt bool) (context.Context, error) {
+	return a.authenticateCredential(ctx, Credential{Authorization: authToken, Dates: date}, isThereAJwt, Client{})
+}
+
+// AuthenticateCall is Authenticate of rpc call to uri with body, ex: the full method of grpc and the request.
+// credential with nonce must be signed for MethodRPC, uri and body, the signed request of cred is ignored
+// so it can't be used for other call. Replay.Required is validated the same as AuthenticateRequest
+func (a *Authenticator[T]) AuthenticateCall(ctx context.Context, cred Credential, uri string, body []byte, isThereAJwt bool) (context.Context, error) {
+	cred.Method, cred.URI, cred.BodyHash = MethodRPC, uri, HashBody(body)
+
+	return a.authenticateCredential(ctx, cred, isThereAJwt, Client{})
+}
+
+// forbidden return err as is when it's *http_response.Error
+func forbidden(ctx context.Context, err error) (context.Context, error) {
+	var e *http_response.Error
+	if errors.As(err, &e) {
+		return ctx, e
+	}
+
+	if err != nil {
+		util.Log.Error().Msg(err.Error())
+	}
+	return ctx, http_response.NewError(http.StatusForbidden, err)
+}
+
+// authenticate validate the signature of the date or request with validate that return the jwt
+func (a *Authenticator[T]) authenticate(ctx context.Context, authToken, date string, isThereAJwt bool, client Client,
+	validate func(date, hmac_jwtToken string) (string, error)) (context.Context, error) {
+	if IsAuthorizationOrDateEmpty(authToken, date) {
+		return forbidden(ctx, ErrDateOrTokenEmpty)
+	}
+
+	hmac_jwtToken, err := GetHmacDate_JwtToken(authToken)
+	if err != nil {
+		return forbidden(ctx, err)
+	}
+
+	authToken, err = validate(date, hmac_jwtToken)
+	if err != nil {
+		return forbidden(ctx, err)
+	}
+
+	if !isThereAJwt {
+		return ctx, nil
+	}
+
+	token, err := jwt.Parse(authToken, a.Keys.JWTKey)
+	if err != nil {
+		// sometimes it will error token is expired
+		return forbidden(ctx, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return ctx, http_response.NewError(http.StatusForbidden, ErrTokenNotValid)
+	}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		util.Log.Error().Msg(err.Error())
+		return forbidden(ctx, nil)
+	}
+
+	var userInfo T
+
+	err = json.Unmarshal(b, &userInfo)
+	if err != nil {
+		util.Log.Error().Msg(err.Error())
+		return forbidden(ctx, nil)
+	}
+
+	impersonating := false
+	if a.Impersonation != nil {
+		impersonating, err = a.Impersonation(ctx, userInfo)
+		if err != nil {
+			return forbidden(ctx, err)
+		}
+	}
+
+	if a.Session != nil && !impersonating {
+		client.Token = authToken
+		if ctx, err = a.Session(ctx, userInfo, client); err != nil {
+			return forbidden(ctx, err)
+		}
+	}
+
+	ctx = context.WithValue(ctx, util.ContextKey(util.ContextClaimsBytes), b)
+	ctx = context.WithValue(ctx, util.ContextKey(util.ContextClaims), userInfo)
+
+	return ctx, nil
+}
+
+// ValidateDate validate the hmac and skew of the date,
+// it return the jwt of hmac_jwtToken
+func (a *Authenticator[T]) ValidateDate(date, hmac_jwtToken string) (string, error) {
+	arrToken := strings.SplitN(hmac_jwtToken, "_", 2)
+
+	if len(arrToken) != 2 {
+		return "", ErrDateNotValid
+	}
+
+	// get hmac from header date
+	sig := hmac.New(sha256.New, a.Keys.DateKey())
+	sig.Write([]byte(date))
+
+	hmac_date := hex.EncodeToString(sig.Sum(nil))
+
+	// compare hmac and authentication
+	if hmac_date != arrToken[0] {
+		return "", ErrHmacNotValid
+	}
+
+	if err := a.validateEpoch(date, a.Skew); err != nil {
+		return "", err
+	}
+
+	return arrToken[1], nil
+}
+
+// validateEpoch check the date is epoch millisecond within skew of now, zero skew use DefaultSkew
+func (a *Authenticator[T]) validateEpoch(date string, skew time.Duration) error {
+	if skew <= 0 {
+		skew = DefaultSkew()
+	}
+
+	epoch, err := strconv.Atoi(date)
+	if err != nil {
+		util.Log.Error().Msg(err.Error())
+		return ErrDateIsNotEpoch
+	}
+
+	since := a.now().Sub(time.UnixMilli(int64(epoch)))
+	if since < 0 {
+		since *= -1
+	}
+
+	if since > skew {
+		return ErrDateExpired
+	}
+
+	return nil
+}
+
+func (a *Authenticator[T]) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+
+	return time.Now()
+}
+
+func IsAuthorizationOrDateEmpty(authorization, date string) bool {
+	return authorization == "" || date == ""
+}
+
+// GetHmacDate_JwtToken remove "Bearer " of the Authorization header
+func GetHmacDate_JwtToken(token string) (string, error) {
+	arrToken := strings.Split(token, "Bearer ")
+	if len(arrToken) != 2 {
+		return "", ErrTokenNotValid
+	}
+
+	return arrToken[1], nil
+}
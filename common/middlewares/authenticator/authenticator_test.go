@@ -0,0 +1,153 @@
+package authenticator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/tigapilarmandiri/perkakas/common/http_response"
+	"github.com/tigapilarmandiri/perkakas/common/util"
+)
+
+// partner is example of a new user population
+type partner struct {
+	AgencyID string `json:"agency_id"`
+	Proxy    bool   `json:"proxy"`
+}
+
+const partnerKey = "partnerKey"
+
+// clientKey is context key of Client that is passed to Session
+type clientKey struct{}
+
+func authorization(t *testing.T, claims jwt.MapClaims, date time.Time) (string, string) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(partnerKey))
+	require.NoError(t, err)
+
+	return header(token, date)
+}
+
+// header return Authorization and Dates header of the token
+func header(token string, date time.Time) (string, string) {
+	dates := strconv.FormatInt(date.UnixMilli(), 10)
+	sig := hmac.New(sha256.New, []byte(partnerKey))
+	sig.Write([]byte(dates))
+
+	return "Bearer " + hex.EncodeToString(sig.Sum(nil)) + "_" + token, dates
+}
+
+func newPartner() *Authenticator[partner] {
+	return &Authenticator[partner]{
+		Keys: HMACKeys(func() (string, string) { return partnerKey, partnerKey }),
+		Session: func(ctx context.Context, claims partner, client Client) (context.Context, error) {
+			if claims.AgencyID == "expired" {
+				return ctx, http_response.NewError(http.StatusPermanentRedirect, errors.New("session not found"))
+			}
+			if claims.AgencyID == "error" {
+				return ctx, errors.New("redis down")
+			}
+			return context.WithValue(ctx, clientKey{}, client), nil
+		},
+		Impersonation: func(ctx context.Context, claims partner) (bool, error) {
+			return claims.Proxy, nil
+		},
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := newPartner()
+	ctx := context.Background()
+
+	auth, date := authorization(t, jwt.MapClaims{"agency_id": "agency-1"}, time.Now())
+	ctx, err := a.Authenticate(ctx, auth, date, true)
+	require.NoError(t, err)
+	require.Equal(t, partner{AgencyID: "agency-1"}, ctx.Value(util.ContextKey(util.ContextClaims)))
+	require.JSONEq(t, `{"agency_id":"agency-1"}`, string(ctx.Value(util.ContextKey(util.ContextClaimsBytes)).([]byte)))
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		status int
+	}{
+		{"session not found", jwt.MapClaims{"agency_id": "expired"}, http.StatusPermanentRedirect},
+		{"session error", jwt.MapClaims{"agency_id": "error"}, http.StatusForbidden},
+		{"impersonation skip session", jwt.MapClaims{"agency_id": "expired", "proxy": true}, 0},
+		{"expired jwt", jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, date := authorization(t, tt.claims, time.Now())
+			_, err := a.Authenticate(context.Background(), auth, date, true)
+			if tt.status == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			var e *http_response.Error
+			require.ErrorAs(t, err, &e)
+			require.Equal(t, tt.status, e.Status)
+		})
+	}
+}
+
+func TestValidateDate(t *testing.T) {
+	now := time.Now()
+	a := newPartner()
+	a.Skew = time.Minute
+	a.Now = func() time.Time { return now }
+
+	auth, date := authorization(t, jwt.MapClaims{}, now.Add(-30*time.Second))
+	_, err := a.Authenticate(context.Background(), auth, date, false)
+	require.NoError(t, err)
+
+	auth, date = authorization(t, jwt.MapClaims{}, now.Add(2*time.Minute))
+	_, err = a.Authenticate(context.Background(), auth, date, false)
+	require.ErrorIs(t, err, ErrDateExpired)
+
+	_, err = a.ValidateDate(date, "tanpa-garis-bawah")
+	require.Equal(t, ErrDateNotValid, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	a := newPartner()
+	handler := a.Middleware(true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(util.ContextKey(util.ContextClaims)).(partner)
+		w.Write([]byte(claims.AgencyID))
+	}))
+
+	auth, date := authorization(t, jwt.MapClaims{"agency_id": "agency-1"}, time.Now())
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", auth)
+	r.Header.Set("Dates", date)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "agency-1", w.Body.String())
+
+	// the session validator get the jwt and client of the request
+	ctx, err := a.AuthenticateRequest(r, true)
+	require.NoError(t, err)
+	client := ctx.Value(clientKey{}).(Client)
+	require.Equal(t, auth[len("Bearer ")+65:], client.Token)
+	require.Equal(t, r.RemoteAddr, client.RemoteAddr)
+
+	// forwarded to rpc
+	ctx, err = a.AuthenticateRPC(context.Background(), CredentialFromRequest(r), "partner.get", nil, true)
+	require.NoError(t, err)
+	require.Equal(t, partner{AgencyID: "agency-1"}, ctx.Value(util.ContextKey(util.ContextClaims)))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
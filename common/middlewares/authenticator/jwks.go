@@ -0,0 +1,401 @@
+package authenticator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	vault "github.com/hashicorp/vault/api"
+	"github.com/tigapilarmandiri/perkakas/common/constant"
+	"github.com/tigapilarmandiri/perkakas/common/util"
+)
+
+const (
+	// DefaultRefreshInterval is how long the key set is cached
+	DefaultRefreshInterval = time.Hour
+	// DefaultMinRefreshInterval limit the refresh of unknown kid
+	DefaultMinRefreshInterval = time.Minute
+)
+
+var (
+	ErrKeyNotFound      = errors.New("jwks: key not found")
+	ErrUnexpectedMethod = errors.New("jwks: unexpected signing method")
+)
+
+// Loader return json of the key set
+type Loader func(ctx context.Context) ([]byte, error)
+
+// FileLoader read the key set from local file
+func FileLoader(path string) Loader {
+	return func(ctx context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}
+}
+
+// URLLoader get the key set from url, ex: https://auth/.well-known/jwks.json
+func URLLoader(url string) Loader {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("jwks: get %s: %s", url, res.Status)
+		}
+
+		return io.ReadAll(res.Body)
+	}
+}
+
+// VaultLoader read field of kv v2 secret, the field is json string or object of the key set
+func VaultLoader(client *vault.Client, mount, path, field string) Loader {
+	return func(ctx context.Context) ([]byte, error) {
+		secret, err := client.KVv2(mount).Get(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+
+		switch v := secret.Data[field].(type) {
+		case nil:
+			return nil, fmt.Errorf("jwks: field %s not found in %s/%s", field, mount, path)
+		case string:
+			return []byte(v), nil
+		default:
+			return json.Marshal(v)
+		}
+	}
+}
+
+// LoaderFromSource return loader of the source:
+//   - https://host/jwks.json or http://host/jwks.json
+//   - vault://mount/path/of/secret#field, address and token is VAULT_ADDRESS and VAULT_TOKEN
+//   - file:///etc/jwks.json or /etc/jwks.json
+func LoaderFromSource(source string) (Loader, error) {
+	switch {
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		return URLLoader(source), nil
+
+	case strings.HasPrefix(source, "vault://"):
+		secretPath, field, _ := strings.Cut(strings.TrimPrefix(source, "vault://"), "#")
+		mount, path, ok := strings.Cut(secretPath, "/")
+		if !ok || field == "" {
+			return nil, fmt.Errorf("jwks: source %s is not vault://mount/path#field", source)
+		}
+
+		config := vault.DefaultConfig()
+		config.Address = os.Getenv(constant.VAULT_ADDRESS)
+
+		client, err := vault.NewClient(config)
+		if err != nil {
+			return nil, err
+		}
+		client.SetToken(os.Getenv(constant.VAULT_TOKEN))
+
+		return VaultLoader(client, mount, path, field), nil
+
+	default:
+		return FileLoader(strings.TrimPrefix(source, "file://")), nil
+	}
+}
+
+// JWKS is cached key set of asymmetric jwt (RS256, PS256, ES256, EdDSA, etc) resolved by kid.
+// the key set is loaded on the first use, refreshed after RefreshInterval
+// and when the kid is unknown, so the keys can be rotated
+type JWKS struct {
+	load Loader
+
+	// RefreshInterval is how long the key set is cached, default is DefaultRefreshInterval
+	RefreshInterval time.Duration
+	// MinRefreshInterval is the min interval of refresh, default is DefaultMinRefreshInterval
+	MinRefreshInterval time.Duration
+
+	refresh  sync.Mutex
+	mu       sync.RWMutex
+	keys     map[string]jwk
+	loadedAt time.Time
+	triedAt  time.Time
+}
+
+func NewJWKS(load Loader) *JWKS {
+	return &JWKS{
+		load:               load,
+		RefreshInterval:    DefaultRefreshInterval,
+		MinRefreshInterval: DefaultMinRefreshInterval,
+	}
+}
+
+var sources sync.Map
+
+// JWKSFromSource return JWKS of LoaderFromSource, it's cached by the source
+func JWKSFromSource(source string) (*JWKS, error) {
+	if s, ok := sources.Load(source); ok {
+		return s.(*JWKS), nil
+	}
+
+	load, err := LoaderFromSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	s, _ := sources.LoadOrStore(source, NewJWKS(load))
+
+	return s.(*JWKS), nil
+}
+
+// Refresh load the key set, the cached keys is kept when it's failed
+func (s *JWKS) Refresh(ctx context.Context) error {
+	s.mu.Lock()
+	s.triedAt = time.Now()
+	s.mu.Unlock()
+
+	b, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJWKS(b)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys, s.loadedAt = keys, time.Now()
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Key return public key of kid, empty kid is allowed when the set has one key
+func (s *JWKS) Key(ctx context.Context, kid string) (any, error) {
+	key, err := s.find(ctx, kid)
+	return key.key, err
+}
+
+func (s *JWKS) find(ctx context.Context, kid string) (jwk, error) {
+	key, ok, stale := s.lookup(kid)
+	if ok && !stale {
+		return key, nil
+	}
+
+	s.refresh.Lock()
+	defer s.refresh.Unlock()
+
+	// other goroutine may have refreshed it
+	key, ok, stale = s.lookup(kid)
+	if (!ok || stale) && s.canRefresh() {
+		if err := s.Refresh(ctx); err != nil {
+			util.Log.Error().Msg("jwks: refresh: " + err.Error())
+		}
+		key, ok, _ = s.lookup(kid)
+	}
+
+	if !ok {
+		return key, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+	}
+
+	return key, nil
+}
+
+// JWTKey is jwt.Keyfunc of the set, the signing method must match type and alg of the key
+func (s *JWKS) JWTKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, err := s.find(context.Background(), kid)
+	if err != nil {
+		return nil, err
+	}
+
+	var ok bool
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok = key.key.(*rsa.PublicKey)
+	case *jwt.SigningMethodECDSA:
+		_, ok = key.key.(*ecdsa.PublicKey)
+	case *jwt.SigningMethodEd25519:
+		_, ok = key.key.(ed25519.PublicKey)
+	}
+	if !ok || (key.alg != "" && key.alg != token.Method.Alg()) {
+		return nil, fmt.Errorf("%w :%v", ErrUnexpectedMethod, token.Header["alg"])
+	}
+
+	return key.key, nil
+}
+
+func (s *JWKS) lookup(kid string) (key jwk, ok, stale bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if kid == "" && len(s.keys) == 1 {
+		for _, k := range s.keys {
+			key, ok = k, true
+		}
+	} else {
+		key, ok = s.keys[kid]
+	}
+
+	return key, ok, time.Since(s.loadedAt) > s.RefreshInterval
+}
+
+// canRefresh limit the refresh, so token with unknown kid can't flood the source
+func (s *JWKS) canRefresh() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.triedAt.IsZero() || time.Since(s.triedAt) > s.MinRefreshInterval
+}
+
+type jwk struct {
+	alg string
+	key any
+}
+
+func parseJWKS(b []byte) (map[string]jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	keys := make(map[string]jwk, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			key any
+			err error
+		)
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k.N, k.E)
+		case "EC":
+			key, err = ecKey(k.Crv, k.X, k.Y)
+		case "OKP":
+			key, err = okpKey(k.Crv, k.X)
+		default:
+			err = fmt.Errorf("unsupported kty %q", k.Kty)
+		}
+		// the set can have key that is not supported, ex: oct or X25519
+		if err != nil {
+			util.Log.Warn().Str("kid", k.Kid).Msg("jwks: skip key: " + err.Error())
+			continue
+		}
+
+		keys[k.Kid] = jwk{alg: k.Alg, key: key}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("jwks: no usable key")
+	}
+
+	return keys, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	modulus, err := decodeInt(n)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent, err := decodeInt(e)
+	if err != nil {
+		return nil, err
+	}
+
+	if modulus.Sign() <= 0 || !exponent.IsInt64() || exponent.Int64() < 2 {
+		return nil, errors.New("invalid rsa key")
+	}
+
+	return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+}
+
+func ecKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported crv %q", crv)
+	}
+
+	px, err := decodeInt(x)
+	if err != nil {
+		return nil, err
+	}
+
+	py, err := decodeInt(y)
+	if err != nil {
+		return nil, err
+	}
+
+	if !curve.IsOnCurve(px, py) {
+		return nil, errors.New("invalid ec key")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: px, Y: py}, nil
+}
+
+func okpKey(crv, x string) (ed25519.PublicKey, error) {
+	if crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported crv %q", crv)
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(x, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 key")
+	}
+
+	return ed25519.PublicKey(b), nil
+}
@@ -0,0 +1,239 @@
+package authenticator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	vault "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+	"github.com/tigapilarmandiri/perkakas/common/util"
+)
+
+type testKeys struct {
+	rsa     *rsa.PrivateKey
+	ec      *ecdsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return testKeys{rsa: rsaKey, ec: ecKey, ed25519: edKey}
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// jwks of the public keys, kid is the alg
+func (k testKeys) jwks() map[string]any {
+	return map[string]any{"keys": []map[string]any{
+		{"kty": "RSA", "kid": "RS256", "alg": "RS256", "use": "sig", "n": encode(k.rsa.N.Bytes()), "e": encode(big.NewInt(int64(k.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "ES256", "crv": "P-256", "x": encode(k.ec.X.Bytes()), "y": encode(k.ec.Y.Bytes())},
+		{"kty": "OKP", "kid": "EdDSA", "crv": "Ed25519", "x": encode(k.ed25519.Public().(ed25519.PublicKey))},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": encode(k.rsa.N.Bytes()), "e": "AQAB"},
+		// unsupported key is skipped
+		{"kty": "oct", "kid": "oct", "k": encode([]byte(partnerKey))},
+		{"kty": "OKP", "kid": "X25519", "crv": "X25519", "x": encode(make([]byte, 32))},
+	}}
+}
+
+func (k testKeys) sign(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.MapClaims) string {
+	var key any
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		key = k.rsa
+	case *jwt.SigningMethodECDSA:
+		key = k.ec
+	case *jwt.SigningMethodEd25519:
+		key = k.ed25519
+	default:
+		key = []byte(partnerKey)
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func TestJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+	b, err := json.Marshal(keys.jwks())
+	require.NoError(t, err)
+
+	set := NewJWKS(func(ctx context.Context) ([]byte, error) { return b, nil })
+	parse := func(token string) error {
+		_, err := jwt.Parse(token, set.JWTKey)
+		return err
+	}
+
+	require.NoError(t, parse(keys.sign(t, jwt.SigningMethodRS256, "RS256", jwt.MapClaims{})))
+	require.NoError(t, parse(keys.sign(t, jwt.SigningMethodES256, "ES256", jwt.MapClaims{})))
+	require.NoError(t, parse(keys.sign(t, jwt.SigningMethodEdDSA, "EdDSA", jwt.MapClaims{})))
+
+	// alg of the key is RS256
+	require.ErrorIs(t, parse(keys.sign(t, jwt.SigningMethodPS256, "RS256", jwt.MapClaims{})), ErrUnexpectedMethod)
+	// key of the kid is not ecdsa
+	require.ErrorIs(t, parse(keys.sign(t, jwt.SigningMethodES256, "EdDSA", jwt.MapClaims{})), ErrUnexpectedMethod)
+	// hmac can't be verified with the public key
+	require.ErrorIs(t, parse(keys.sign(t, jwt.SigningMethodHS256, "RS256", jwt.MapClaims{})), ErrUnexpectedMethod)
+	// the key is not for signature
+	require.ErrorIs(t, parse(keys.sign(t, jwt.SigningMethodRS256, "enc", jwt.MapClaims{})), ErrKeyNotFound)
+	require.ErrorIs(t, parse(keys.sign(t, jwt.SigningMethodHS256, "oct", jwt.MapClaims{})), ErrKeyNotFound)
+	// empty kid is not allowed when the set has more than one key
+	require.ErrorIs(t, parse(keys.sign(t, jwt.SigningMethodRS256, "", jwt.MapClaims{})), ErrKeyNotFound)
+}
+
+func TestParseJWKS(t *testing.T) {
+	keys, err := parseJWKS([]byte(`{"keys":[{"kty":"oct","kid":"oct","k":"c2VjcmV0"},{"kty":"RSA","kid":"bad","n":"","e":"AQAB"}]}`))
+	require.Error(t, err)
+	require.Nil(t, keys)
+
+	_, err = parseJWKS([]byte(`{"keys":`))
+	require.Error(t, err)
+}
+
+func TestJWKSRefresh(t *testing.T) {
+	oldKeys, newKeys := newTestKeys(t), newTestKeys(t)
+
+	var calls atomic.Int32
+	current := oldKeys
+	set := NewJWKS(func(ctx context.Context) ([]byte, error) {
+		calls.Add(1)
+		return json.Marshal(current.jwks())
+	})
+
+	_, err := set.Key(context.Background(), "RS256")
+	require.NoError(t, err)
+	_, err = set.Key(context.Background(), "RS256")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), calls.Load())
+
+	// unknown kid is refreshed at most once per MinRefreshInterval
+	_, err = set.Key(context.Background(), "unknown")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+	require.Equal(t, int32(1), calls.Load())
+
+	// the keys is rotated
+	current = newKeys
+	set.MinRefreshInterval = 0
+	_, err = jwt.Parse(newKeys.sign(t, jwt.SigningMethodRS256, "RS256", jwt.MapClaims{}), set.JWTKey)
+	require.Error(t, err)
+
+	set.RefreshInterval = time.Nanosecond
+	_, err = jwt.Parse(newKeys.sign(t, jwt.SigningMethodRS256, "RS256", jwt.MapClaims{}), set.JWTKey)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), calls.Load())
+}
+
+func TestLoader(t *testing.T) {
+	keys := newTestKeys(t)
+	b, err := json.Marshal(keys.jwks())
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(file, b, 0o600))
+
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(b)
+	}))
+	defer jwksServer.Close()
+
+	vaultServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/auth" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{"data": map[string]any{"jwks": keys.jwks()}},
+		})
+	}))
+	defer vaultServer.Close()
+
+	config := vault.DefaultConfig()
+	config.Address = vaultServer.URL
+	client, err := vault.NewClient(config)
+	require.NoError(t, err)
+
+	loaders := map[string]Loader{
+		"file":  FileLoader(file),
+		"url":   URLLoader(jwksServer.URL),
+		"vault": VaultLoader(client, "secret", "auth", "jwks"),
+	}
+
+	for name, load := range loaders {
+		t.Run(name, func(t *testing.T) {
+			set := NewJWKS(load)
+			require.NoError(t, set.Refresh(context.Background()))
+
+			key, err := set.Key(context.Background(), "EdDSA")
+			require.NoError(t, err)
+			require.Equal(t, keys.ed25519.Public(), key)
+		})
+	}
+
+	_, err = LoaderFromSource("vault://secret")
+	require.Error(t, err)
+}
+
+func TestKeys(t *testing.T) {
+	keys := newTestKeys(t)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	b, err := json.Marshal(keys.jwks())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(file, b, 0o600))
+
+	source := ""
+	a := &Authenticator[partner]{
+		Keys: Keys(func() (string, string, string) { return partnerKey, partnerKey, source }),
+	}
+
+	authenticate := func(token string) error {
+		auth, date := header(token, time.Now())
+		_, err := a.Authenticate(context.Background(), auth, date, true)
+		return err
+	}
+
+	hs256 := keys.sign(t, jwt.SigningMethodHS256, "", jwt.MapClaims{"agency_id": "agency-1"})
+	es256 := keys.sign(t, jwt.SigningMethodES256, "ES256", jwt.MapClaims{"agency_id": "agency-1"})
+
+	require.NoError(t, authenticate(hs256))
+	require.Error(t, authenticate(es256))
+
+	source = "file://" + file
+	require.Error(t, authenticate(hs256))
+
+	ctx := context.Background()
+	auth, date := header(es256, time.Now())
+	ctx, err = a.Authenticate(ctx, auth, date, true)
+	require.NoError(t, err)
+	require.Equal(t, partner{AgencyID: "agency-1"}, ctx.Value(util.ContextKey(util.ContextClaims)))
+}
@@ -0,0 +1,57 @@
+package authenticator
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// KeyProvider return the key of the date hmac and the key to verify the jwt,
+// it's called on every request so the key can be rotated or loaded after the configs
+type KeyProvider interface {
+	DateKey() []byte
+	// JWTKey is jwt.Keyfunc, it must check the signing method of the token
+	JWTKey(token *jwt.Token) (any, error)
+}
+
+// HMACKeys is KeyProvider of HS256, HS384 and HS512 jwt,
+// it return the date key and the secret key, ex: from configs.Config.JWT
+type HMACKeys func() (dateKey, secretKey string)
+
+func (k HMACKeys) DateKey() []byte {
+	dateKey, _ := k()
+	return []byte(dateKey)
+}
+
+func (k HMACKeys) JWTKey(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method :%v", token.Header["alg"])
+	}
+
+	_, secretKey := k()
+	return []byte(secretKey), nil
+}
+
+// Keys is KeyProvider that verify the jwt with the key set of jwks source when it's not empty,
+// so only the auth service need the private key. the secret key is used otherwise.
+// the source is the same as JWKSFromSource, ex: configs.Config.JWT.JWKS
+type Keys func() (dateKey, secretKey, jwks string)
+
+func (k Keys) DateKey() []byte {
+	dateKey, _, _ := k()
+	return []byte(dateKey)
+}
+
+func (k Keys) JWTKey(token *jwt.Token) (any, error) {
+	dateKey, secretKey, source := k()
+	if source == "" {
+		return HMACKeys(func() (string, string) { return dateKey, secretKey }).JWTKey(token)
+	}
+
+	set, err := JWKSFromSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return set.JWTKey(token)
+}
@@ -0,0 +1,289 @@
+package authenticator
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tigapilarmandiri/perkakas/common/http_response"
+	"github.com/tigapilarmandiri/perkakas/common/rds"
+	"github.com/tigapilarmandiri/perkakas/configs"
+)
+
+// HeaderNonce is header of unique value of every signed request
+const HeaderNonce = "Nonce"
+
+// MethodRPC is the signed method of rpc call, the uri is the subject or the full method of grpc
+const MethodRPC = "RPC"
+
+// DefaultNoncePrefix is key prefix of the used nonce
+const DefaultNoncePrefix = "nonce-"
+
+// DefaultReplaySkew is the max difference between the date of signed request and now
+const DefaultReplaySkew = 5 * time.Minute
+
+// DefaultMaxBodySize is max body of signed request that is read to verify the signature
+const DefaultMaxBodySize = 10 << 20
+
+var (
+	ErrSignatureRequired = errors.New("request signature is required")
+	ErrNonceNotValid     = errors.New("nonce not valid")
+	ErrNonceUsed         = errors.New("nonce is already used")
+	ErrBodyTooLarge      = errors.New("request body is too large")
+	errCheckNonce        = errors.New("failed to check nonce")
+)
+
+// Replay protect request from being replayed. the client send Nonce header
+// and sign the request with Sign instead of the date only,
+// so the Authorization header can't be used for other request or used twice.
+// request without Nonce header is validated with the legacy signature unless it's required.
+// it's applied to http request and Credential of rpc request
+type Replay struct {
+	// Nonces store the used nonce, default is rds.GetClient()
+	Nonces rds.Rediser
+
+	// Skew is the max difference between the date and now,
+	// zero use configs.Config.JWT.SignatureSkew or DefaultReplaySkew
+	Skew time.Duration
+
+	// Required reject the legacy signature, it's also required when configs.Config.JWT.SignatureRequired is true
+	Required bool
+
+	// MaxBodySize is max body that is read before the authentication, larger body is refused with 413.
+	// zero use configs.Config.JWT.SignatureMaxBodySize or DefaultMaxBodySize
+	MaxBodySize int64
+
+	// Prefix is key prefix of the used nonce, default is DefaultNoncePrefix.
+	// verifiers that share Nonces and must not see the nonce of each other need their own prefix
+	Prefix string
+}
+
+func (p *Replay) nonces() rds.Rediser {
+	if p.Nonces != nil {
+		return p.Nonces
+	}
+
+	return rds.GetClient()
+}
+
+func (p *Replay) prefix() string {
+	if p.Prefix != "" {
+		return p.Prefix
+	}
+
+	return DefaultNoncePrefix
+}
+
+func (p *Replay) skew() time.Duration {
+	if p.Skew > 0 {
+		return p.Skew
+	}
+
+	if configs.Config.JWT.SignatureSkew > 0 {
+		return time.Duration(configs.Config.JWT.SignatureSkew) * time.Second
+	}
+
+	return DefaultReplaySkew
+}
+
+func (p *Replay) required() bool {
+	return p.Required || configs.Config.JWT.SignatureRequired
+}
+
+// maxBodySize is also used by CredentialFromRequest without Replay, p can be nil
+func (p *Replay) maxBodySize() int64 {
+	if p != nil && p.MaxBodySize > 0 {
+		return p.MaxBodySize
+	}
+
+	if configs.Config.JWT.SignatureMaxBodySize > 0 {
+		return int64(configs.Config.JWT.SignatureMaxBodySize)
+	}
+
+	return DefaultMaxBodySize
+}
+
+// HashBody return hex of sha256 of the body, it's the body hash of Credential
+func HashBody(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// Sign return hmac of the request with the date key, it's sent as "Bearer <signature>_<jwt>".
+// uri is path and query of the request, ex: /users?page=2
+func Sign(dateKey []byte, method, uri, date, nonce string, body []byte) string {
+	return sign(dateKey, method, uri, date, nonce, HashBody(body))
+}
+
+func sign(dateKey []byte, method, uri, date, nonce, bodyHash string) string {
+	sig := hmac.New(sha256.New, dateKey)
+	sig.Write([]byte(strings.Join([]string{method, uri, date, nonce, bodyHash}, "\n")))
+
+	return hex.EncodeToString(sig.Sum(nil))
+}
+
+// AuthenticateRequest is Authenticate of http request.
+// request with Nonce header is validated with the signature of Sign when Replay is set,
+// the nonce can be used once within the skew
+func (a *Authenticator[T]) AuthenticateRequest(r *http.Request, isThereAJwt bool) (context.Context, error) {
+	ctx := r.Context()
+	client := Client{RemoteAddr: r.RemoteAddr, UserAgent: r.UserAgent()}
+
+	cred := Credential{Authorization: r.Header.Get("Authorization"), Dates: r.Header.Get("Dates")}
+	if a.Replay != nil {
+		var err error
+		if cred, err = credentialFromRequest(r, a.Replay.maxBodySize()); err != nil {
+			return forbidden(ctx, err)
+		}
+	}
+
+	return a.authenticateCredential(ctx, cred, isThereAJwt, client)
+}
+
+// authenticateCredential validate the nonce signature of cred when it has nonce,
+// otherwise the legacy signature of the date unless the signature is required
+func (a *Authenticator[T]) authenticateCredential(ctx context.Context, cred Credential, isThereAJwt bool, client Client) (context.Context, error) {
+	if a.Replay == nil || cred.Nonce == "" {
+		if a.Replay != nil && a.Replay.required() {
+			return forbidden(ctx, ErrSignatureRequired)
+		}
+		return a.authenticate(ctx, cred.Authorization, cred.Dates, isThereAJwt, client, a.ValidateDate)
+	}
+
+	return a.authenticate(ctx, cred.Authorization, cred.Dates, isThereAJwt, client, func(date, hmac_jwtToken string) (string, error) {
+		return a.validateSignature(ctx, cred, hmac_jwtToken)
+	})
+}
+
+func (a *Authenticator[T]) validateSignature(ctx context.Context, cred Credential, hmac_jwtToken string) (string, error) {
+	if len(cred.Nonce) < 16 || len(cred.Nonce) > 128 {
+		return "", ErrNonceNotValid
+	}
+
+	arrToken := strings.SplitN(hmac_jwtToken, "_", 2)
+	if len(arrToken) != 2 {
+		return "", ErrDateNotValid
+	}
+
+	signature := sign(a.Keys.DateKey(), cred.Method, cred.URI, cred.Dates, cred.Nonce, cred.BodyHash)
+	if !hmac.Equal([]byte(signature), []byte(arrToken[0])) {
+		return "", ErrHmacNotValid
+	}
+
+	skew := a.Replay.skew()
+	if err := a.validateEpoch(cred.Dates, skew); err != nil {
+		return "", err
+	}
+
+	// the date is valid until now + skew, so the nonce must be kept for twice of the skew
+	ok, err := a.Replay.nonces().SetNX(ctx, a.Replay.prefix()+cred.Nonce, cred.Dates, 2*skew).Result()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errCheckNonce, err)
+	}
+	if !ok {
+		return "", ErrNonceUsed
+	}
+
+	return arrToken[1], nil
+}
+
+// Forward sign cred again for the rpc call of uri with body, the date is now and the nonce is new.
+// the credential of the gateway is verified and its nonce is used, so it can't be forwarded as is,
+// and the signature of the http request doesn't bind it to the rpc call.
+// cred must be authenticated before it's forwarded, credential without nonce is returned as is
+func (a *Authenticator[T]) Forward(cred Credential, uri string, body []byte) (Credential, error) {
+	if cred.Nonce == "" {
+		return cred, nil
+	}
+
+	hmac_jwtToken, err := GetHmacDate_JwtToken(cred.Authorization)
+	if err != nil {
+		return cred, err
+	}
+
+	arrToken := strings.SplitN(hmac_jwtToken, "_", 2)
+	if len(arrToken) != 2 {
+		return cred, ErrDateNotValid
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return cred, err
+	}
+
+	forwarded := Credential{
+		Dates:    strconv.FormatInt(a.now().UnixMilli(), 10),
+		Nonce:    nonce,
+		Method:   MethodRPC,
+		URI:      uri,
+		BodyHash: HashBody(body),
+	}
+	signature := sign(a.Keys.DateKey(), forwarded.Method, forwarded.URI, forwarded.Dates, forwarded.Nonce, forwarded.BodyHash)
+	forwarded.Authorization = "Bearer " + signature + "_" + arrToken[1]
+
+	return forwarded, nil
+}
+
+// newNonce return 32 random hex
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// credentialFromRequest return credential of r, the signed request is added when it has Nonce header
+func credentialFromRequest(r *http.Request, maxBodySize int64) (Credential, error) {
+	cred := Credential{
+		Authorization: r.Header.Get("Authorization"),
+		Dates:         r.Header.Get("Dates"),
+		Nonce:         r.Header.Get(HeaderNonce),
+	}
+	if cred.Nonce == "" {
+		return cred, nil
+	}
+
+	body, err := readBody(r, maxBodySize)
+	if err != nil {
+		return cred, err
+	}
+
+	cred.Method, cred.URI, cred.BodyHash = r.Method, r.URL.RequestURI(), HashBody(body)
+
+	return cred, nil
+}
+
+// readBody read at most maxBodySize of the body and put it back for the next handler,
+// larger body is *http_response.Error with status 413
+func readBody(r *http.Request, maxBodySize int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	r.Body.Close()
+
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return nil, http_response.NewError(http.StatusRequestEntityTooLarge, ErrBodyTooLarge)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
@@ -0,0 +1,174 @@
+package authenticator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/tigapilarmandiri/perkakas/common/rds/rdstest"
+	"github.com/tigapilarmandiri/perkakas/common/util"
+)
+
+func signedRequest(t *testing.T, method, uri, body, nonce string, date time.Time) *http.Request {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"agency_id": "agency-1"}).SignedString([]byte(partnerKey))
+	require.NoError(t, err)
+
+	dates := strconv.FormatInt(date.UnixMilli(), 10)
+	r := httptest.NewRequest(method, uri, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+Sign([]byte(partnerKey), method, uri, dates, nonce, []byte(body))+"_"+token)
+	r.Header.Set("Dates", dates)
+	r.Header.Set(HeaderNonce, nonce)
+
+	return r
+}
+
+func TestReplay(t *testing.T) {
+	nonces := rdstest.New()
+	a := newPartner()
+	a.Replay = &Replay{Nonces: nonces, Skew: time.Minute}
+
+	var body string
+	handler := a.Middleware(true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+
+	serve := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	nonce := "0123456789abcdef"
+	require.Equal(t, http.StatusOK, serve(signedRequest(t, http.MethodPost, "/users?page=1", `{"name":"budi"}`, nonce, time.Now())))
+	// the body is still readable by the handler
+	require.Equal(t, `{"name":"budi"}`, body)
+	require.Equal(t, 2*time.Minute, nonces.TTL[DefaultNoncePrefix+nonce])
+
+	// the same nonce is replayed
+	require.Equal(t, http.StatusForbidden, serve(signedRequest(t, http.MethodPost, "/users?page=1", `{"name":"budi"}`, nonce, time.Now())))
+
+	// the signature is for other request
+	r := signedRequest(t, http.MethodPost, "/users?page=1", `{"name":"budi"}`, "fedcba9876543210", time.Now())
+	r.URL.RawQuery = "page=2"
+	require.Equal(t, http.StatusForbidden, serve(r))
+
+	r = signedRequest(t, http.MethodPost, "/users", `{"name":"budi"}`, "fedcba9876543211", time.Now())
+	r.Body = io.NopCloser(strings.NewReader(`{"name":"andi"}`))
+	require.Equal(t, http.StatusForbidden, serve(r))
+
+	// out of the skew
+	require.Equal(t, http.StatusForbidden, serve(signedRequest(t, http.MethodGet, "/", "", "fedcba9876543212", time.Now().Add(-2*time.Minute))))
+
+	// nonce is too short
+	require.Equal(t, http.StatusForbidden, serve(signedRequest(t, http.MethodGet, "/", "", "pendek", time.Now())))
+
+	// the nonce can't be checked
+	nonces.Err = errors.New("redis down")
+	require.Equal(t, http.StatusForbidden, serve(signedRequest(t, http.MethodGet, "/", "", "fedcba9876543213", time.Now())))
+	nonces.Err = nil
+
+	// legacy signature is accepted unless it's required
+	legacy := func() *http.Request {
+		auth, date := authorization(t, jwt.MapClaims{"agency_id": "agency-1"}, time.Now())
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", auth)
+		r.Header.Set("Dates", date)
+		return r
+	}
+	require.Equal(t, http.StatusOK, serve(legacy()))
+
+	a.Replay.Required = true
+	require.Equal(t, http.StatusForbidden, serve(legacy()))
+	require.Equal(t, http.StatusOK, serve(signedRequest(t, http.MethodDelete, "/users/1", "", "fedcba9876543214", time.Now())))
+}
+
+func TestReplayCredential(t *testing.T) {
+	nonces := rdstest.New()
+	a := newPartner()
+	a.Replay = &Replay{Nonces: nonces, Skew: time.Minute, Required: true}
+	ctx := context.Background()
+
+	// legacy signature of rpc is refused too
+	auth, date := authorization(t, jwt.MapClaims{"agency_id": "agency-1"}, time.Now())
+	_, err := a.Authenticate(ctx, auth, date, true)
+	require.ErrorIs(t, err, ErrSignatureRequired)
+
+	_, err = a.AuthenticateRPC(ctx, []byte(`{"authorization":"`+auth+`","dates":"`+date+`"}`), "users.create", nil, true)
+	require.ErrorIs(t, err, ErrSignatureRequired)
+
+	// signed http request is authenticated by the gateway then forwarded
+	r := signedRequest(t, http.MethodPost, "/users?page=1", `{"name":"budi"}`, "0123456789abcdef", time.Now())
+	_, err = a.AuthenticateRequest(r, true)
+	require.NoError(t, err)
+
+	data := []byte(`{"nama":"budi"}`)
+	cred := a.ForwardRPC(CredentialFromRequest(r), "users.create", data)
+	ctx, err = a.AuthenticateRPC(ctx, cred, "users.create", data, true)
+	require.NoError(t, err)
+	require.Equal(t, partner{AgencyID: "agency-1"}, ctx.Value(util.ContextKey(util.ContextClaims)))
+
+	_, err = a.AuthenticateRPC(ctx, cred, "users.create", data, true)
+	require.ErrorIs(t, err, ErrNonceUsed)
+
+	// the signature is for other call
+	cred = a.ForwardRPC(CredentialFromRequest(r), "users.create", data)
+	_, err = a.AuthenticateRPC(ctx, cred, "users.delete", data, true)
+	require.ErrorIs(t, err, ErrHmacNotValid)
+	_, err = a.AuthenticateRPC(ctx, cred, "users.create", []byte(`{"nama":"andi"}`), true)
+	require.ErrorIs(t, err, ErrHmacNotValid)
+
+	// the signature of http request is not for the call
+	r = signedRequest(t, http.MethodPost, "/users", `{"name":"budi"}`, "fedcba9876543210", time.Now())
+	_, err = a.AuthenticateRPC(ctx, CredentialFromRequest(r), "users.create", []byte(`{"name":"budi"}`), true)
+	require.ErrorIs(t, err, ErrHmacNotValid)
+
+	// legacy credential is forwarded as is
+	legacy := []byte(`{"authorization":"` + auth + `","dates":"` + date + `"}`)
+	require.Equal(t, legacy, a.ForwardRPC(legacy, "users.create", nil))
+}
+
+func TestReplayPrefix(t *testing.T) {
+	nonces := rdstest.New()
+	gateway, service := newPartner(), newPartner()
+	gateway.Replay = &Replay{Nonces: nonces}
+	service.Replay = &Replay{Nonces: nonces, Prefix: "service-nonce-"}
+
+	cred := CredentialFromRequest(signedRequest(t, http.MethodGet, "/", "", "0123456789abcdef", time.Now()))
+	var c Credential
+	require.NoError(t, json.Unmarshal(cred, &c))
+
+	// the nonce of other verifier is not used
+	_, err := gateway.authenticateCredential(context.Background(), c, true, Client{})
+	require.NoError(t, err)
+	_, err = service.authenticateCredential(context.Background(), c, true, Client{})
+	require.NoError(t, err)
+	_, err = service.authenticateCredential(context.Background(), c, true, Client{})
+	require.ErrorIs(t, err, ErrNonceUsed)
+
+	require.Contains(t, nonces.Data, DefaultNoncePrefix+c.Nonce)
+	require.Contains(t, nonces.Data, "service-nonce-"+c.Nonce)
+}
+
+func TestReplayMaxBodySize(t *testing.T) {
+	a := newPartner()
+	a.Replay = &Replay{Nonces: rdstest.New(), MaxBodySize: 16}
+
+	serve := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		a.Middleware(true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, serve(signedRequest(t, http.MethodPost, "/", `{"name":"budi"}`, "0123456789abcdef", time.Now())))
+	require.Equal(t, http.StatusRequestEntityTooLarge, serve(signedRequest(t, http.MethodPost, "/", `{"name":"budi santoso"}`, "fedcba9876543210", time.Now())))
+}
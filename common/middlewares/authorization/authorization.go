@@ -21,6 +21,10 @@ import (
 
 var errUnauthorized = errors.New("you're not authorized")
 
+func init() {
+	http_response.RegisterError(errUnauthorized, http.StatusForbidden)
+}
+
 type GetRedis func(context.Context, string) ([]byte, error)
 
 var defaultGetRedis GetRedis = func(ctx context.Context, key string) ([]byte, error) {
@@ -31,106 +35,113 @@ var defaultGetRedis GetRedis = func(ctx context.Context, key string) ([]byte, er
 func Authorization(f GetRedis) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			if configs.Config.Env == "local" {
-				next.ServeHTTP(w, r)
-				return
-			}
-			ctx := r.Context()
-			claims, ok := ctx.Value(util.ContextKey(util.ContextClaims)).(Claims)
-			if !ok {
-				util.Log.Error().Msg(errUnauthorized.Error())
-				http_response.SendForbiddenResponse(w, errUnauthorized)
-				return
-			}
+			path := r.URL.Path
 
-			if claims.IsSuperadmin {
-				next.ServeHTTP(w, r)
-				return
+			for _, v := range keys {
+				if s := chi.URLParam(r, v); s != "" {
+					path = strings.ReplaceAll(path, s, "*")
+				}
 			}
 
-			if f == nil {
-				f = defaultGetRedis
-			}
+			path = strings.ReplaceAll(path, "/", "_")
 
-			b, err := f(ctx, configs.Config.Redis.RedisAuthKey)
-			if err != nil {
-				util.Log.Error().Msg(err.Error())
-				http_response.SendForbiddenResponse(w, errUnauthorized)
+			if err := Authorize(r.Context(), f, r.Method, path); err != nil {
+				http_response.SendForbiddenResponse(w, err)
 				return
 			}
 
-			var permissions Permission
-			err = json.Unmarshal(b, &permissions)
-			if err != nil {
-				util.Log.Error().Msg(err.Error())
-				http_response.SendForbiddenResponse(w, errUnauthorized)
-				return
-			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
 
-			if len(claims.Roles) == 0 {
-				http_response.SendForbiddenResponse(w, errUnauthorized)
-				return
-			}
+// ClaimsFromContext return claims that is added by authentication
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(util.ContextKey(util.ContextClaims)).(Claims)
+	return claims, ok
+}
 
-			if claims.IsSuperadmin && configs.Config.IsUseELK {
-				trx := apm.TransactionFromContext(ctx)
-				defer trx.End()
+// Authorize check permission of the claims in ctx, it's used by http and rpc handler.
+// path is the permission key, ex: _users_* and method is POST (C), GET (R), PATCH (U) or DELETE (D)
+func Authorize(ctx context.Context, f GetRedis, method, path string) error {
+	if configs.Config.Env == "local" {
+		return nil
+	}
 
-				trx.Context.SetLabel("username", claims.UserName)
-			}
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		util.Log.Error().Msg(errUnauthorized.Error())
+		return errUnauthorized
+	}
 
-			path := r.URL.Path
+	if claims.IsSuperadmin {
+		return nil
+	}
 
-			for _, v := range keys {
-				if s := chi.URLParam(r, v); s != "" {
-					path = strings.ReplaceAll(path, s, "*")
-				}
-			}
+	if f == nil {
+		f = defaultGetRedis
+	}
 
-			path = strings.ReplaceAll(path, "/", "_")
+	b, err := f(ctx, configs.Config.Redis.RedisAuthKey)
+	if err != nil {
+		util.Log.Error().Msg(err.Error())
+		return errUnauthorized
+	}
 
-			for _, v := range claims.Roles {
-				permission, ok := permissions[v.Uuid]
-				if !ok {
-					continue
-				}
+	var permissions Permission
+	err = json.Unmarshal(b, &permissions)
+	if err != nil {
+		util.Log.Error().Msg(err.Error())
+		return errUnauthorized
+	}
 
-				userPermission := strings.ToUpper(permission[path])
-				switch r.Method {
-				case "POST":
-					if strings.Contains(userPermission, "C") {
-						next.ServeHTTP(w, r)
-						return
-					}
-				case "GET":
-					if strings.Contains(userPermission, "R") {
-						next.ServeHTTP(w, r)
-						return
-					}
-				case "PATCH":
-					if strings.Contains(userPermission, "U") {
-						next.ServeHTTP(w, r)
-						return
-					}
-				case "DELETE":
-					if strings.Contains(userPermission, "D") {
-						next.ServeHTTP(w, r)
-						return
-					}
-				}
-			}
+	if len(claims.Roles) == 0 {
+		return errUnauthorized
+	}
 
-			var roles []string
-			for _, v := range claims.Roles {
-				roles = append(roles, v.Name)
-			}
-			sRoles := strings.Join(roles, ", ")
+	if claims.IsSuperadmin && configs.Config.IsUseELK {
+		trx := apm.TransactionFromContext(ctx)
+		defer trx.End()
 
-			util.Log.Error().Msg(fmt.Sprintf("permission not permitted or not set: [%s] -> %s : %s", sRoles, r.Method, path))
-			http_response.SendForbiddenResponse(w, errUnauthorized)
+		trx.Context.SetLabel("username", claims.UserName)
+	}
+
+	for _, v := range claims.Roles {
+		permission, ok := permissions[v.Uuid]
+		if !ok {
+			continue
 		}
-		return http.HandlerFunc(fn)
+
+		userPermission := strings.ToUpper(permission[path])
+		switch method {
+		case "POST":
+			if strings.Contains(userPermission, "C") {
+				return nil
+			}
+		case "GET":
+			if strings.Contains(userPermission, "R") {
+				return nil
+			}
+		case "PATCH":
+			if strings.Contains(userPermission, "U") {
+				return nil
+			}
+		case "DELETE":
+			if strings.Contains(userPermission, "D") {
+				return nil
+			}
+		}
+	}
+
+	var roles []string
+	for _, v := range claims.Roles {
+		roles = append(roles, v.Name)
 	}
+	sRoles := strings.Join(roles, ", ")
+
+	util.Log.Error().Msg(fmt.Sprintf("permission not permitted or not set: [%s] -> %s : %s", sRoles, method, path))
+	return errUnauthorized
 }
 
 var (
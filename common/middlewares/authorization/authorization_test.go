@@ -66,7 +66,7 @@ func TestAuthorization(t *testing.T) {
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 
-	respUnauthorize := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"you're not authorized"}}`
+	respUnauthorize := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"you're not authorized"}}`
 
 	if status, resp := test.TestRequest(t, ts, "POST", "/users/asdf", nil, nil); status != http.StatusForbidden || resp != respUnauthorize {
 		t.Errorf(resp)
@@ -111,3 +111,39 @@ func TestQueryValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthorize(t *testing.T) {
+	authFunc := func(ctx context.Context, key string) ([]byte, error) {
+		return json.Marshal(Permission{
+			"uuid-1": map[string]string{
+				"users.get": "R",
+			},
+		})
+	}
+
+	ctx := context.WithValue(context.Background(), util.ContextKey(util.ContextClaims), Claims{
+		Roles: []Role{{Uuid: "uuid-1", Name: "testing"}},
+	})
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		method   string
+		path     string
+		expected error
+	}{
+		{"permitted", ctx, http.MethodGet, "users.get", nil},
+		{"wrong method", ctx, http.MethodDelete, "users.get", errUnauthorized},
+		{"not set", ctx, http.MethodGet, "users.delete", errUnauthorized},
+		{"without claims", context.Background(), http.MethodGet, "users.get", errUnauthorized},
+		{"superadmin", context.WithValue(context.Background(), util.ContextKey(util.ContextClaims), Claims{IsSuperadmin: true}), http.MethodDelete, "users.delete", nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := Authorize(tt.ctx, authFunc, tt.method, tt.path); actual != tt.expected {
+				t.Errorf("expected %v, actual %v", tt.expected, actual)
+			}
+		})
+	}
+}
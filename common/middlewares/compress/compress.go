@@ -0,0 +1,294 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	encodingBrotli = "br"
+	encodingZstd   = "zstd"
+	encodingGzip   = "gzip"
+
+	defaultMinSize = 1024
+)
+
+// preferred encoding when client accept more than one with the same quality
+var supportedEncodings = []string{encodingBrotli, encodingZstd, encodingGzip}
+
+// content type that is already compressed
+var defaultSkipContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/x-brotli",
+	"application/pdf",
+	"application/octet-stream",
+}
+
+type Options struct {
+	// AllowPaths is prefix of url path that can be compressed,
+	// to avoid BREACH, don't add path that return secret (ex: token, session)
+	// together with data from the request
+	AllowPaths []string
+
+	// Allow is called when the path is not in AllowPaths
+	Allow func(r *http.Request) bool
+
+	// MinSize skip response smaller than MinSize bytes, default is 1024
+	MinSize int
+
+	// SkipContentTypes is added to the default list of content type that is already compressed
+	SkipContentTypes []string
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	encodingBrotli: {New: func() any { return brotli.NewWriterLevel(nil, brotli.DefaultCompression) }},
+	encodingZstd: {New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		return enc
+	}},
+	encodingGzip: {New: func() any { return gzip.NewWriter(nil) }},
+}
+
+// Handler compress response with br, zstd or gzip based on Accept-Encoding,
+// only response of allowed path is compressed.
+// response that set Cache-Control no-store or Set-Cookie is never compressed because it's likely contain secret
+func Handler(opts Options) func(http.Handler) http.Handler {
+	if opts.MinSize <= 0 {
+		opts.MinSize = defaultMinSize
+	}
+	opts.SkipContentTypes = append(opts.SkipContentTypes, defaultSkipContentTypes...)
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if !opts.allowed(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiate(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, opts: &opts, encoding: encoding}
+			defer cw.Close()
+
+			next.ServeHTTP(cw, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func (opts *Options) allowed(r *http.Request) bool {
+	for _, path := range opts.AllowPaths {
+		if strings.HasPrefix(r.URL.Path, path) {
+			return true
+		}
+	}
+
+	return opts.Allow != nil && opts.Allow(r)
+}
+
+// negotiate return encoding with the highest quality from Accept-Encoding,
+// empty string is returned when no supported encoding is accepted
+func negotiate(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+
+	for _, enc := range supportedEncodings {
+		for _, v := range strings.Split(acceptEncoding, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(v), ";")
+			if !strings.EqualFold(strings.TrimSpace(name), enc) {
+				continue
+			}
+
+			q := 1.0
+			if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+				var err error
+				if q, err = strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64); err != nil {
+					q = 0
+				}
+			}
+
+			if q > bestQ {
+				best, bestQ = enc, q
+			}
+		}
+	}
+
+	return best
+}
+
+// compressWriter buffer the response until MinSize to decide whether it's compressed
+type compressWriter struct {
+	http.ResponseWriter
+	opts     *Options
+	encoding string
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+
+	// informational response is sent directly
+	if status >= 100 && status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.opts.MinSize {
+			return len(b), nil
+		}
+
+		if err := cw.decide(false); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush is used by streaming response, the response is compressed
+// even when the size is still smaller than MinSize
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(true); err != nil {
+			return
+		}
+	}
+
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+
+	if cw.enc == nil {
+		return nil
+	}
+
+	err := cw.enc.Close()
+	cw.enc.Reset(nil)
+	encoderPools[cw.encoding].Put(cw.enc)
+	cw.enc = nil
+
+	return err
+}
+
+// decide write the header and buffered body, compressed or not
+func (cw *compressWriter) decide(streaming bool) error {
+	cw.decided = true
+
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if cw.shouldCompress(streaming) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+
+		cw.enc = encoderPools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+
+	return err
+}
+
+func (cw *compressWriter) shouldCompress(streaming bool) bool {
+	if cw.status < 200 || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified || cw.status == http.StatusPartialContent {
+		return false
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Set-Cookie") != "" ||
+		strings.Contains(strings.ToLower(h.Get("Cache-Control")), "no-store") {
+		return false
+	}
+
+	if l, err := strconv.Atoi(h.Get("Content-Length")); err == nil && l < cw.opts.MinSize {
+		return false
+	}
+
+	if !streaming && len(cw.buf) < cw.opts.MinSize {
+		return false
+	}
+
+	contentType := strings.ToLower(h.Get("Content-Type"))
+	for _, skip := range cw.opts.SkipContentTypes {
+		if strings.HasPrefix(contentType, skip) {
+			return false
+		}
+	}
+
+	return true
+}
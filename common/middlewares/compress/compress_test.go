@@ -0,0 +1,119 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+var largeBody = `{"status":200,"message":"success","data":"` + strings.Repeat("wilayah ", 500) + `"}`
+
+func newHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/wilayah", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(largeBody))
+	})
+	mux.HandleFunc("/wilayah/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"status":200}`))
+	})
+	mux.HandleFunc("/wilayah/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(largeBody))
+	})
+	mux.HandleFunc("/wilayah/secret", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte(largeBody))
+	})
+	mux.HandleFunc("/wilayah/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for i := 0; i < 3; i++ {
+			w.Write([]byte(`{"id":1}` + "\n"))
+			w.(http.Flusher).Flush()
+		}
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(largeBody))
+	})
+
+	return Handler(Options{AllowPaths: []string{"/wilayah"}})(mux)
+}
+
+func decode(t *testing.T, encoding string, body io.Reader) string {
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gr, err := gzip.NewReader(body)
+		require.NoError(t, err)
+		r = gr
+	case "br":
+		r = brotli.NewReader(body)
+	case "zstd":
+		zr, err := zstd.NewReader(body)
+		require.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	default:
+		r = body
+	}
+
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return string(b)
+}
+
+func TestCompress(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		encoding       string
+		expected       string
+	}{
+		{"gzip", "/wilayah", "gzip, deflate", "gzip", largeBody},
+		{"br", "/wilayah", "gzip, deflate, br", "br", largeBody},
+		{"zstd", "/wilayah", "gzip;q=0.5, zstd", "zstd", largeBody},
+		{"quality", "/wilayah", "br;q=0.1, gzip;q=0.8", "gzip", largeBody},
+		{"rejected", "/wilayah", "gzip;q=0", "", largeBody},
+		{"not accepted", "/wilayah", "", "", largeBody},
+		{"small", "/wilayah/small", "gzip", "", `{"status":200}`},
+		{"already compressed", "/wilayah/image", "gzip", "", largeBody},
+		{"no-store", "/wilayah/secret", "gzip", "", largeBody},
+		{"not allowed", "/login", "gzip", "", largeBody},
+		{"stream", "/wilayah/stream", "gzip", "gzip", strings.Repeat(`{"id":1}`+"\n", 3)},
+	}
+
+	svr := httptest.NewServer(newHandler())
+	defer svr.Close()
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, svr.URL+tt.path, nil)
+			require.NoError(t, err)
+			// avoid transparent decompression of http client
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, tt.encoding, resp.Header.Get("Content-Encoding"))
+			require.Equal(t, tt.expected, decode(t, tt.encoding, resp.Body))
+
+			if tt.path != "/login" {
+				require.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+			}
+		})
+	}
+}
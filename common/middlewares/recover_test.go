@@ -19,6 +19,7 @@ func TestRecover(t *testing.T) {
 	responseError := http_response.HttpResponse{
 		Status:  http.StatusForbidden,
 		Message: constant.MSG_FORBIDDEN_ACCESS,
+		Code:    constant.CODE_FORBIDDEN,
 		Data:    nil,
 	}
 
@@ -45,6 +46,7 @@ func TestRecoverWithLog(t *testing.T) {
 	responseError := http_response.HttpResponse{
 		Status:  http.StatusForbidden,
 		Message: constant.MSG_FORBIDDEN_ACCESS,
+		Code:    constant.CODE_FORBIDDEN,
 		Data:    nil,
 	}
 
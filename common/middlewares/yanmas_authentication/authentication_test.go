@@ -153,7 +153,7 @@ func TestNoJwt(t *testing.T) {
 	defer ts.Close()
 
 	// sending empty date
-	respEmptyToken := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
+	respEmptyToken := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
 
 	if status, resp := test.TestRequest(t, ts, "GET", "/", nil, nil); status != http.StatusForbidden || resp != respEmptyToken {
 		t.Fatalf(resp)
@@ -169,7 +169,7 @@ func TestNoJwt(t *testing.T) {
 	h := make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"date is expired"}}`
+	respReq := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"date is expired"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -206,7 +206,7 @@ func TestAuthentication(t *testing.T) {
 	defer ts.Close()
 
 	// sending empty token and date
-	respEmptyToken := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
+	respEmptyToken := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
 
 	if status, resp := test.TestRequest(t, ts, "GET", "/", nil, nil); status != http.StatusForbidden || resp != respEmptyToken {
 		t.Fatalf(resp)
@@ -220,21 +220,21 @@ func TestAuthentication(t *testing.T) {
 		t.Fatal(err)
 	}
 	h.Set("Authorization", token)
-	respWrongKey := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
+	respWrongKey := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respWrongKey {
 		t.Fatalf(resp)
 	}
 
 	// sending wrong jwt token and empty date
 	h.Set("Authorization", "asdf")
-	respWrongJWT := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
+	respWrongJWT := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respWrongJWT {
 		t.Fatalf(resp)
 	}
 
 	// sending expired token and empty date
 	jwtToken = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": time.Now().Add(-30 * time.Second).Unix()})
-	respTokenExpired := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
+	respTokenExpired := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token or date is empty"}}`
 	token, err = jwtToken.SignedString([]byte(key))
 	if err != nil {
 		t.Fatal(err)
@@ -272,7 +272,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", token)
 	h.Set("Dates", strconv.Itoa(int(time.Now().UnixMilli())))
-	respReq := `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token not valid"}}`
+	respReq := `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token not valid"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -287,7 +287,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"date is expired"}}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"date is expired"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -302,7 +302,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"date is expired"}}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"date is expired"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -317,7 +317,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"date is not epoch"}}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"date is not epoch"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -332,7 +332,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message+"a")
-	respReq = `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"hmac not valid"}}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"hmac not valid"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -353,7 +353,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message2)
-	respReq = `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"hmac not valid"}}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"hmac not valid"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -368,7 +368,7 @@ func TestAuthentication(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null,"debug":{"error":true,"error_message":"token contains an invalid number of segments"}}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null,"debug":{"error":true,"error_message":"token contains an invalid number of segments"}}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp, status)
 	}
@@ -406,7 +406,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	defer ts.Close()
 
 	// sending empty token and date
-	respEmptyToken := `{"status":403,"message":"forbidden access","data":null}`
+	respEmptyToken := `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 
 	if status, resp := test.TestRequest(t, ts, "GET", "/", nil, nil); status != http.StatusForbidden || resp != respEmptyToken {
 		t.Fatalf(resp)
@@ -427,21 +427,21 @@ func TestAuthenticationProduction(t *testing.T) {
 		t.Fatal(err)
 	}
 	h.Set("Authorization", token)
-	respWrongKey := `{"status":403,"message":"forbidden access","data":null}`
+	respWrongKey := `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respWrongKey {
 		t.Fatalf(resp)
 	}
 
 	// sending wrong jwt token and empty date
 	h.Set("Authorization", "asdf")
-	respWrongJWT := `{"status":403,"message":"forbidden access","data":null}`
+	respWrongJWT := `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respWrongJWT {
 		t.Fatalf(resp)
 	}
 
 	// sending expired token and empty date
 	jwtToken = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": time.Now().Add(-30 * time.Second).Unix()})
-	respTokenExpired := `{"status":403,"message":"forbidden access","data":null}`
+	respTokenExpired := `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	token, err = jwtToken.SignedString([]byte(key))
 	if err != nil {
 		t.Fatal(err)
@@ -474,7 +474,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", token)
 	h.Set("Dates", strconv.Itoa(int(time.Now().UnixMilli())))
-	respReq := `{"status":403,"message":"forbidden access","data":null}`
+	respReq := `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -489,7 +489,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -504,7 +504,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -519,7 +519,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -534,7 +534,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message+"a")
-	respReq = `{"status":403,"message":"forbidden access","data":null}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -555,7 +555,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message2)
-	respReq = `{"status":403,"message":"forbidden access","data":null}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
@@ -570,7 +570,7 @@ func TestAuthenticationProduction(t *testing.T) {
 	h = make(http.Header)
 	h.Set("Authorization", "Bearer "+ttoken)
 	h.Set("Dates", message)
-	respReq = `{"status":403,"message":"forbidden access","data":null}`
+	respReq = `{"status":403,"message":"forbidden access","code":"forbidden","data":null}`
 	if status, resp := test.TestRequest(t, ts, "GET", "/", h, nil); status != http.StatusForbidden || resp != respReq {
 		t.Fatalf(resp)
 	}
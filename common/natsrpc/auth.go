@@ -0,0 +1,26 @@
+package natsrpc
+
+import (
+	"context"
+
+	"github.com/dzrock1989/perkakas/common/http_response"
+	"github.com/dzrock1989/perkakas/common/middlewares/authentication"
+	"github.com/dzrock1989/perkakas/proto"
+)
+
+// Authentication validate proto.Requests.Authorization that is forwarded with
+// WithAuthorization(authentication.CredentialFromRequest(r)),
+// the nonce signature must be of the subject and the data, see Client.Request.
+// the claims is added to ctx of the handler like authentication.Authentication
+func Authentication(isThereAJwt bool) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req *proto.Requests) *proto.Responses {
+			ctx, err := authentication.AuthenticateRPC(ctx, req.GetAuthorization(), Subject(ctx), req.GetData(), isThereAJwt)
+			if err != nil {
+				return http_response.ToError(err).ToProto()
+			}
+
+			return next(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package natsrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dzrock1989/perkakas/common/http_response"
+	"github.com/dzrock1989/perkakas/common/middlewares/authentication"
+	"github.com/dzrock1989/perkakas/common/pagination"
+	"github.com/dzrock1989/perkakas/proto"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/nats-io/nats.go"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+func init() {
+	http_response.RegisterError(nats.ErrNoResponders, http.StatusServiceUnavailable)
+	http_response.RegisterError(nats.ErrTimeout, http.StatusGatewayTimeout)
+	// handler that is cancelled by deadline of the caller
+	http_response.RegisterError(context.DeadlineExceeded, http.StatusGatewayTimeout)
+}
+
+// Client send request to Server and wait for the reply
+type Client struct {
+	transport transport
+
+	// Timeout is used when ctx has no deadline, default is DefaultTimeout
+	Timeout time.Duration
+}
+
+func NewClient(conn *nats.Conn) *Client {
+	return newClient(natsTransport{conn: conn})
+}
+
+func newClient(t transport) *Client {
+	return &Client{transport: t, Timeout: DefaultTimeout}
+}
+
+// CallOption set field of the request
+type CallOption func(req *proto.Requests)
+
+// WithAuthorization forward authorization of the caller, ex: claims or token.
+// credential with nonce is signed again for the subject and the data, see Client.Request
+func WithAuthorization(authorization []byte) CallOption {
+	return func(req *proto.Requests) {
+		req.Authorization = authorization
+	}
+}
+
+// WithUuid pass the uuid to the handler
+func WithUuid(uuid string) CallOption {
+	return func(req *proto.Requests) {
+		req.Uuid = uuid
+	}
+}
+
+// WithOption pass page, limit, filter and sort to the handler
+func WithOption(opt pagination.Option) CallOption {
+	return func(req *proto.Requests) {
+		req.Meta = opt.RequestMeta()
+	}
+}
+
+// Request send req to subject, deadline and request id of ctx is propagated to the handler.
+// credential of authentication.CredentialFromRequest in req.Authorization is signed for subject and req.Data
+// with authentication.ForwardRPC, so the credential that is authenticated by the gateway can be verified once.
+// timeout is returned as nats.ErrTimeout and subject without handler as nats.ErrNoResponders
+func (c *Client) Request(ctx context.Context, subject string, req *proto.Requests) (*proto.Responses, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := c.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if len(req.Authorization) > 0 {
+		req.Authorization = authentication.ForwardRPC(req.Authorization, subject, req.Data)
+	}
+
+	data, err := protobuf.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.Header.Set(HeaderDeadline, strconv.FormatInt(deadline.UnixNano(), 10))
+	}
+	if id := middleware.GetReqID(ctx); id != "" {
+		msg.Header.Set(HeaderRequestID, id)
+	}
+
+	reply, err := c.transport.request(ctx, msg)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = nats.ErrTimeout
+		}
+		return nil, fmt.Errorf("natsrpc: %s: %w", subject, err)
+	}
+
+	var res proto.Responses
+	if err = protobuf.Unmarshal(reply.Data, &res); err != nil {
+		return nil, fmt.Errorf("natsrpc: %s: %w", subject, err)
+	}
+
+	return &res, nil
+}
+
+// Call send params as json to subject and decode data of the reply into R.
+// non 2xx reply is returned as *http_response.Error, so it can be sent with http_response.SendError as is
+func Call[R any](ctx context.Context, c *Client, subject string, params any, opts ...CallOption) (data R, meta *proto.ResponseMeta, err error) {
+	req := &proto.Requests{}
+	if params != nil {
+		if req.Data, err = json.Marshal(params); err != nil {
+			return
+		}
+	}
+
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	res, err := c.Request(ctx, subject, req)
+	if err != nil {
+		return
+	}
+
+	if res.GetStatus() < http.StatusOK || res.GetStatus() >= http.StatusMultipleChoices {
+		err = http_response.ErrorFromProto(res)
+		return
+	}
+
+	if len(res.GetData()) > 0 {
+		if err = json.Unmarshal(res.GetData(), &data); err != nil {
+			return
+		}
+	}
+
+	meta = res.GetMeta()
+
+	return
+}
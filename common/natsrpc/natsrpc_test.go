@@ -0,0 +1,424 @@
+package natsrpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dzrock1989/perkakas/common/http_response"
+	"github.com/dzrock1989/perkakas/common/middlewares/authentication"
+	"github.com/dzrock1989/perkakas/common/middlewares/authentication/authenticationtest"
+	"github.com/dzrock1989/perkakas/common/middlewares/authorization"
+	"github.com/dzrock1989/perkakas/common/pagination"
+	"github.com/dzrock1989/perkakas/proto"
+	"github.com/go-chi/chi/v5/middleware"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+	protobuf "google.golang.org/protobuf/proto"
+	"gorm.io/gorm"
+)
+
+// memTransport is in memory nats, every subject only has one subscriber
+type memTransport struct {
+	mu      sync.Mutex
+	subs    map[string]nats.MsgHandler
+	inboxes map[string]chan *nats.Msg
+	n       int
+}
+
+func newMemTransport() *memTransport {
+	return &memTransport{subs: map[string]nats.MsgHandler{}, inboxes: map[string]chan *nats.Msg{}}
+}
+
+func (t *memTransport) subscribe(subject, _ string, fn nats.MsgHandler) (func() error, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.subs[subject] = fn
+
+	return func() error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		delete(t.subs, subject)
+		return nil
+	}, nil
+}
+
+func (t *memTransport) publish(msg *nats.Msg) error {
+	t.mu.Lock()
+	inbox, ok := t.inboxes[msg.Subject]
+	fn := t.subs[msg.Subject]
+	t.mu.Unlock()
+
+	if ok {
+		inbox <- msg
+	} else if fn != nil {
+		fn(msg)
+	}
+
+	return nil
+}
+
+func (t *memTransport) request(ctx context.Context, msg *nats.Msg) (*nats.Msg, error) {
+	t.mu.Lock()
+	fn, ok := t.subs[msg.Subject]
+	if !ok {
+		t.mu.Unlock()
+		return nil, nats.ErrNoResponders
+	}
+
+	t.n++
+	msg.Reply = fmt.Sprintf("_INBOX.%d", t.n)
+	inbox := make(chan *nats.Msg, 1)
+	t.inboxes[msg.Reply] = inbox
+	t.mu.Unlock()
+
+	fn(msg)
+
+	select {
+	case reply := <-inbox:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type testParams struct {
+	Name string `json:"name"`
+}
+
+type testResult struct {
+	Greeting string `json:"greeting"`
+	Uuid     string `json:"uuid"`
+	Page     int    `json:"page"`
+}
+
+func newTestServer(t *testing.T) (*Server, *Client) {
+	mem := newMemTransport()
+	s := newServer(mem, "test")
+	t.Cleanup(func() { require.NoError(t, s.Shutdown()) })
+
+	return s, newClient(mem)
+}
+
+func TestCall(t *testing.T) {
+	s, c := newTestServer(t)
+
+	Handle(s, "greet", func(ctx context.Context, req Request[testParams]) (testResult, *proto.ResponseMeta, error) {
+		if req.Params.Name == "" {
+			return testResult{}, nil, gorm.ErrRecordNotFound
+		}
+
+		req.Option.TotalRows = 1
+		return testResult{Greeting: "halo " + req.Params.Name, Uuid: req.Uuid, Page: req.Option.Page}, req.Option.ProtoMeta(), nil
+	})
+	require.NoError(t, s.Start())
+
+	ctx := context.Background()
+
+	res, meta, err := Call[testResult](ctx, c, "greet", testParams{Name: "budi"}, WithUuid("abc"), WithOption(pagination.Option{Page: 2, Limit: 10}))
+	require.NoError(t, err)
+	require.Equal(t, testResult{Greeting: "halo budi", Uuid: "abc", Page: 2}, res)
+	require.Equal(t, int32(2), meta.GetPage())
+	require.Equal(t, int64(1), meta.GetTotalData())
+
+	// error from handler is mapped with the error registry
+	_, _, err = Call[testResult](ctx, c, "greet", testParams{})
+	var e *http_response.Error
+	require.ErrorAs(t, err, &e)
+	require.Equal(t, http.StatusNotFound, e.Status)
+	require.Equal(t, http.StatusNotFound, http_response.ToError(err).Status)
+
+	// invalid params
+	_, _, err = Call[testResult](ctx, c, "greet", []string{"budi"})
+	require.ErrorAs(t, err, &e)
+	require.Equal(t, http.StatusBadRequest, e.Status)
+
+	// no handler
+	_, _, err = Call[testResult](ctx, c, "unknown", nil)
+	require.ErrorIs(t, err, nats.ErrNoResponders)
+	require.Equal(t, http.StatusServiceUnavailable, http_response.ToError(err).Status)
+}
+
+func TestMiddleware(t *testing.T) {
+	s, c := newTestServer(t)
+
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	record := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, req *proto.Requests) *proto.Responses {
+				mu.Lock()
+				calls = append(calls, name)
+				mu.Unlock()
+
+				if string(req.GetAuthorization()) == "" {
+					return http_response.NewError(http.StatusUnauthorized, nil).ToProto()
+				}
+				return next(ctx, req)
+			}
+		}
+	}
+
+	s.HandleFunc("panic", func(ctx context.Context, req *proto.Requests) *proto.Responses {
+		panic("boom")
+	})
+	s.Use(record("first"), record("second"))
+	require.NoError(t, s.Start())
+
+	ctx := context.Background()
+
+	_, _, err := Call[any](ctx, c, "panic", nil)
+	var e *http_response.Error
+	require.ErrorAs(t, err, &e)
+	require.Equal(t, http.StatusUnauthorized, e.Status)
+	require.Equal(t, []string{"first"}, calls)
+
+	_, _, err = Call[any](ctx, c, "panic", nil, WithAuthorization([]byte("token")))
+	require.ErrorAs(t, err, &e)
+	require.Equal(t, http.StatusInternalServerError, e.Status)
+	require.Equal(t, []string{"first", "first", "second"}, calls)
+}
+
+func TestContextPropagation(t *testing.T) {
+	s, c := newTestServer(t)
+
+	Handle(s, "deadline", func(ctx context.Context, req Request[any]) (string, *proto.ResponseMeta, error) {
+		deadline, _ := ctx.Deadline()
+		return middleware.GetReqID(ctx) + " " + deadline.Format(time.RFC3339Nano), nil, nil
+	})
+	Handle(s, "slow", func(ctx context.Context, req Request[any]) (string, *proto.ResponseMeta, error) {
+		<-ctx.Done()
+		return "", nil, ctx.Err()
+	})
+	require.NoError(t, s.Start())
+
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.WithValue(context.Background(), middleware.RequestIDKey, "req-1"), deadline)
+	defer cancel()
+
+	res, _, err := Call[string](ctx, c, "deadline", nil)
+	require.NoError(t, err)
+	require.Equal(t, "req-1 "+deadline.Format(time.RFC3339Nano), res)
+
+	// handler is cancelled together with the caller,
+	// the caller get either timeout or the reply of the cancelled handler
+	c.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	_, _, err = Call[string](context.Background(), c, "slow", nil)
+	require.Equal(t, http.StatusGatewayTimeout, http_response.ToError(err).Status)
+	require.Less(t, time.Since(start), time.Second)
+
+	// subscriber that never reply
+	_, err = c.transport.subscribe("silent", "test", func(*nats.Msg) {})
+	require.NoError(t, err)
+
+	_, _, err = Call[string](context.Background(), c, "silent", nil)
+	require.ErrorIs(t, err, nats.ErrTimeout)
+	require.True(t, strings.HasPrefix(err.Error(), "natsrpc: silent"))
+	require.Equal(t, http.StatusGatewayTimeout, http_response.ToError(err).Status)
+}
+
+func TestAuthentication(t *testing.T) {
+	s, c := newTestServer(t)
+
+	Handle(s, "authorized", func(ctx context.Context, req Request[any]) (string, *proto.ResponseMeta, error) {
+		if err := authorization.Authorize(ctx, nil, http.MethodGet, "authorized"); err != nil {
+			return "", nil, err
+		}
+
+		claims, _ := authorization.ClaimsFromContext(ctx)
+		return claims.UserUUID, nil, nil
+	})
+	s.Use(Authentication(true))
+	require.NoError(t, s.Start())
+
+	_, _, err := Call[string](context.Background(), c, "authorized", nil)
+	var e *http_response.Error
+	require.ErrorAs(t, err, &e)
+	require.Equal(t, http.StatusForbidden, e.Status)
+
+	// credential of http request forwarded by the gateway
+	authenticationtest.Setup(t)
+	r := authenticationtest.Request(t, http.MethodGet, "/", "", "")
+
+	res, _, err := Call[string](context.Background(), c, "authorized", nil, WithAuthorization(authentication.CredentialFromRequest(r)))
+	require.NoError(t, err)
+	require.Equal(t, authenticationtest.UserUUID, res)
+}
+
+func TestAuthenticationSignatureRequired(t *testing.T) {
+	s, c := newTestServer(t)
+
+	Handle(s, "signed", func(ctx context.Context, req Request[any]) (string, *proto.ResponseMeta, error) {
+		claims, _ := authorization.ClaimsFromContext(ctx)
+		return claims.UserUUID, nil, nil
+	})
+	Handle(s, "other", func(ctx context.Context, req Request[any]) (string, *proto.ResponseMeta, error) {
+		return "other", nil, nil
+	})
+	s.Use(Authentication(true))
+	require.NoError(t, s.Start())
+
+	authenticationtest.Setup(t)
+	authenticationtest.RequireSignature(t)
+
+	// legacy signature of the date only
+	r := authenticationtest.Request(t, http.MethodGet, "/", "", "")
+	_, _, err := Call[string](context.Background(), c, "signed", nil, WithAuthorization(authentication.CredentialFromRequest(r)))
+	var e *http_response.Error
+	require.ErrorAs(t, err, &e)
+	require.Equal(t, http.StatusForbidden, e.Status)
+
+	// http request signed with nonce is authenticated by the gateway then forwarded
+	gateway := authentication.Authentication(true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, _, err := Call[string](r.Context(), c, "signed", map[string]string{"nama": "budi"}, WithAuthorization(authentication.CredentialFromRequest(r)))
+		if err != nil {
+			http_response.SendError(w, r, err)
+			return
+		}
+		w.Write([]byte(res))
+	}))
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		gateway.ServeHTTP(w, r)
+		return w
+	}
+
+	body := `{"name":"budi"}`
+	signed := func() *http.Request {
+		return authenticationtest.Request(t, http.MethodPost, "/users?page=1", body, "0123456789abcdef")
+	}
+
+	w := serve(signed())
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, authenticationtest.UserUUID, w.Body.String())
+
+	// replayed to the gateway
+	require.Equal(t, http.StatusForbidden, serve(signed()).Code)
+
+	// forwarded credential is only for its subject and data, it's sent without Client.Request that sign it again
+	cred := authentication.ForwardRPC(authentication.CredentialFromRequest(signed()), "signed", []byte(`{"nama":"budi"}`))
+	send := func(cred []byte, subject, data string) int32 {
+		b, err := protobuf.Marshal(&proto.Requests{Data: []byte(data), Authorization: cred})
+		require.NoError(t, err)
+
+		msg := nats.NewMsg(subject)
+		msg.Data = b
+		reply, err := c.transport.request(context.Background(), msg)
+		require.NoError(t, err)
+
+		var res proto.Responses
+		require.NoError(t, protobuf.Unmarshal(reply.Data, &res))
+		return res.GetStatus()
+	}
+	require.Equal(t, int32(http.StatusForbidden), send(cred, "other", `{"nama":"budi"}`))
+	require.Equal(t, int32(http.StatusForbidden), send(cred, "signed", `{"nama":"andi"}`))
+	require.Equal(t, int32(http.StatusOK), send(cred, "signed", `{"nama":"budi"}`))
+
+	// the credential of http request is not for the subject
+	require.Equal(t, int32(http.StatusForbidden), send(authentication.CredentialFromRequest(signed()), "signed", body))
+}
+
+func TestMaxWorkers(t *testing.T) {
+	s, c := newTestServer(t)
+	s.MaxWorkers = 2
+
+	var mu sync.Mutex
+	running, max := 0, 0
+	release := make(chan struct{})
+	Handle(s, "work", func(ctx context.Context, req Request[any]) (string, *proto.ResponseMeta, error) {
+		mu.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+
+		<-release
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return "done", nil, nil
+	})
+	require.NoError(t, s.Start())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, _, err := Call[string](context.Background(), c, "work", nil)
+			require.NoError(t, err)
+			require.Equal(t, "done", res)
+		}()
+	}
+
+	// the other messages wait for a worker
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return running == 2
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	close(release)
+	wg.Wait()
+	require.Equal(t, 2, max)
+}
+
+func TestNATS(t *testing.T) {
+	ns := natsserver.RunRandClientPortServer()
+	t.Cleanup(ns.Shutdown)
+
+	conn, err := nats.Connect(ns.ClientURL())
+	require.NoError(t, err)
+	t.Cleanup(conn.Close)
+
+	// every instance of the service subscribe with the same queue group
+	served := make([]int, 2)
+	var mu sync.Mutex
+	for i := range served {
+		i := i
+		s := NewServer(conn, "test")
+		Handle(s, "greet", func(ctx context.Context, req Request[testParams]) (testResult, *proto.ResponseMeta, error) {
+			mu.Lock()
+			served[i]++
+			mu.Unlock()
+
+			deadline, _ := ctx.Deadline()
+			return testResult{Greeting: "halo " + req.Params.Name, Uuid: middleware.GetReqID(ctx) + " " + deadline.Format(time.RFC3339Nano)}, nil, nil
+		})
+		require.NoError(t, s.Start())
+		t.Cleanup(func() { require.NoError(t, s.Shutdown()) })
+	}
+
+	c := NewClient(conn)
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.WithValue(context.Background(), middleware.RequestIDKey, "req-1"), deadline)
+	defer cancel()
+
+	for i := 0; i < 10; i++ {
+		res, _, err := Call[testResult](ctx, c, "greet", testParams{Name: "budi"})
+		require.NoError(t, err)
+		require.Equal(t, testResult{Greeting: "halo budi", Uuid: "req-1 " + deadline.Format(time.RFC3339Nano)}, res)
+	}
+
+	mu.Lock()
+	require.Equal(t, 10, served[0]+served[1])
+	mu.Unlock()
+
+	_, _, err = Call[testResult](ctx, c, "unknown", nil)
+	require.ErrorIs(t, err, nats.ErrNoResponders)
+	require.Equal(t, http.StatusServiceUnavailable, http_response.ToError(err).Status)
+}
@@ -0,0 +1,284 @@
+package natsrpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dzrock1989/perkakas/common/constant"
+	"github.com/dzrock1989/perkakas/common/http_response"
+	"github.com/dzrock1989/perkakas/common/pagination"
+	"github.com/dzrock1989/perkakas/common/params"
+	"github.com/dzrock1989/perkakas/common/util"
+	"github.com/dzrock1989/perkakas/proto"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/nats-io/nats.go"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// headers to propagate context of the caller
+const (
+	// HeaderDeadline is deadline of the caller in unix nano
+	HeaderDeadline = "Rpc-Deadline"
+	// HeaderRequestID is the default request id header of chi middleware.RequestID
+	HeaderRequestID = "X-Request-Id"
+)
+
+// DefaultTimeout is used when the caller doesn't send deadline
+const DefaultTimeout = 30 * time.Second
+
+// DefaultMaxWorkers is max handlers that run at the same time on a server
+const DefaultMaxWorkers = 1000
+
+type subjectKey struct{}
+
+// Subject return subject of the request that is handled with ctx
+func Subject(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectKey{}).(string)
+	return subject
+}
+
+// HandlerFunc handle request of a subject and return the reply
+type HandlerFunc func(ctx context.Context, req *proto.Requests) *proto.Responses
+
+// Middleware wrap HandlerFunc, ex: authentication, logging
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Request is decoded request of typed handler
+type Request[T any] struct {
+	// Params is decoded from data of the request
+	Params T
+	// Option is pagination option from meta of the request
+	Option pagination.Option
+
+	Uuid          string
+	Authorization []byte
+}
+
+// Server subscribe the registered subjects with queue group,
+// so request is load balanced to every instance of the service
+type Server struct {
+	transport transport
+	queue     string
+
+	// Timeout of handler when the caller doesn't send deadline, default is DefaultTimeout
+	Timeout time.Duration
+
+	// MaxWorkers is max handlers that run at the same time, default is DefaultMaxWorkers.
+	// the next message wait until a handler is done, so a burst is queued by nats instead.
+	// zero or less is unlimited, it must be set before Start
+	MaxWorkers int
+
+	mu          sync.Mutex
+	workers     chan struct{}
+	middlewares []Middleware
+	handlers    map[string]HandlerFunc
+	drains      []func() error
+	wg          sync.WaitGroup
+}
+
+func NewServer(conn *nats.Conn, queue string) *Server {
+	return newServer(natsTransport{conn: conn}, queue)
+}
+
+func newServer(t transport, queue string) *Server {
+	return &Server{
+		transport:  t,
+		queue:      queue,
+		Timeout:    DefaultTimeout,
+		MaxWorkers: DefaultMaxWorkers,
+		handlers:   map[string]HandlerFunc{},
+	}
+}
+
+// Use add middlewares to every handler, the first middleware is the outermost.
+// it must be called before Start
+func (s *Server) Use(middlewares ...Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// HandleFunc register handler of subject, it must be called before Start
+func (s *Server) HandleFunc(subject string, h HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.handlers[subject]; ok {
+		panic("natsrpc: handler of " + subject + " is already registered")
+	}
+
+	s.handlers[subject] = h
+}
+
+// Handle register typed handler of subject, data of the request is decoded into T with params.Decode
+// and the returned data is encoded as json.
+// error is replied with status and message from http_response.ToError
+func Handle[T any, R any](s *Server, subject string, fn func(ctx context.Context, req Request[T]) (R, *proto.ResponseMeta, error)) {
+	s.HandleFunc(subject, func(ctx context.Context, req *proto.Requests) *proto.Responses {
+		r := Request[T]{
+			Option:        pagination.OptionFromProto(req.GetMeta()),
+			Uuid:          req.GetUuid(),
+			Authorization: req.GetAuthorization(),
+		}
+
+		if len(req.GetData()) > 0 {
+			if err := params.Decode(req.GetData(), &r.Params); err != nil {
+				return http_response.NewError(http.StatusBadRequest, err).ToProto()
+			}
+		}
+
+		data, meta, err := fn(ctx, r)
+		if err != nil {
+			return ErrorResponse(err)
+		}
+
+		res, err := http_response.HttpResponse{Data: data}.ToProto()
+		if err != nil {
+			return ErrorResponse(err)
+		}
+
+		res.Status = http.StatusOK
+		res.Message = constant.MSG_SUCCESS
+		res.Meta = meta
+
+		return res
+	})
+}
+
+// ErrorResponse convert err into reply using the error registry of http_response,
+// internal server error is logged
+func ErrorResponse(err error) *proto.Responses {
+	e := http_response.ToError(err)
+	if e.Status >= http.StatusInternalServerError {
+		util.Log.Error().Msg(err.Error())
+	}
+
+	return e.ToProto()
+}
+
+// Start subscribe every registered subject
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.MaxWorkers > 0 && s.workers == nil {
+		s.workers = make(chan struct{}, s.MaxWorkers)
+	}
+
+	for subject, h := range s.handlers {
+		for i := len(s.middlewares) - 1; i >= 0; i-- {
+			h = s.middlewares[i](h)
+		}
+
+		drain, err := s.transport.subscribe(subject, s.queue, s.serve(h))
+		if err != nil {
+			return fmt.Errorf("natsrpc: subscribe %s: %w", subject, err)
+		}
+
+		s.drains = append(s.drains, drain)
+	}
+
+	return nil
+}
+
+// Shutdown stop receiving new request and wait the running handlers to finish
+func (s *Server) Shutdown() error {
+	s.mu.Lock()
+	drains := s.drains
+	s.drains = nil
+	s.mu.Unlock()
+
+	var err error
+	for _, drain := range drains {
+		if e := drain(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	s.wg.Wait()
+
+	return err
+}
+
+// serve run every message on its own goroutine within MaxWorkers,
+// nats call the handler of a subscription one by one
+func (s *Server) serve(h HandlerFunc) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		if s.workers != nil {
+			s.workers <- struct{}{}
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if s.workers != nil {
+				defer func() { <-s.workers }()
+			}
+
+			ctx, cancel := s.context(msg)
+			defer cancel()
+
+			res := s.handle(ctx, h, msg.Data)
+			if msg.Reply == "" {
+				return
+			}
+
+			b, err := protobuf.Marshal(res)
+			if err != nil {
+				util.Log.Error().Msg(err.Error())
+				b, _ = protobuf.Marshal(http_response.NewError(http.StatusInternalServerError, nil).ToProto())
+			}
+
+			reply := nats.NewMsg(msg.Reply)
+			reply.Data = b
+			if err = s.transport.publish(reply); err != nil {
+				util.Log.Error().Msg(err.Error())
+			}
+		}()
+	}
+}
+
+// context use deadline and request id of the caller, the subject is added for Subject
+func (s *Server) context(msg *nats.Msg) (context.Context, context.CancelFunc) {
+	ctx := context.WithValue(context.Background(), subjectKey{}, msg.Subject)
+	if id := msg.Header.Get(HeaderRequestID); id != "" {
+		ctx = context.WithValue(ctx, middleware.RequestIDKey, id)
+	}
+
+	if deadline, err := strconv.ParseInt(msg.Header.Get(HeaderDeadline), 10, 64); err == nil {
+		return context.WithDeadline(ctx, time.Unix(0, deadline))
+	}
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (s *Server) handle(ctx context.Context, h HandlerFunc, data []byte) (res *proto.Responses) {
+	defer func() {
+		if rvr := recover(); rvr != nil {
+			util.Log.Error().Msgf("natsrpc: panic: %v\n%s", rvr, debug.Stack())
+			res = http_response.NewError(http.StatusInternalServerError, nil).ToProto()
+		}
+	}()
+
+	var req proto.Requests
+	if err := protobuf.Unmarshal(data, &req); err != nil {
+		return http_response.NewError(http.StatusBadRequest, err).ToProto()
+	}
+
+	if res = h(ctx, &req); res == nil {
+		res = http_response.NewError(http.StatusInternalServerError, nil).ToProto()
+	}
+
+	return res
+}
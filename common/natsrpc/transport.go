@@ -0,0 +1,42 @@
+package natsrpc
+
+import (
+	"context"
+
+	"github.com/dzrock1989/perkakas/configs"
+	"github.com/nats-io/nats.go"
+)
+
+// transport is the part of nats connection used by Server and Client,
+// it's replaced by in memory transport on test
+type transport interface {
+	subscribe(subject, queue string, fn nats.MsgHandler) (drain func() error, err error)
+	publish(msg *nats.Msg) error
+	request(ctx context.Context, msg *nats.Msg) (*nats.Msg, error)
+}
+
+type natsTransport struct {
+	conn *nats.Conn
+}
+
+func (t natsTransport) subscribe(subject, queue string, fn nats.MsgHandler) (func() error, error) {
+	sub, err := t.conn.QueueSubscribe(subject, queue, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return sub.Drain, nil
+}
+
+func (t natsTransport) publish(msg *nats.Msg) error {
+	return t.conn.PublishMsg(msg)
+}
+
+func (t natsTransport) request(ctx context.Context, msg *nats.Msg) (*nats.Msg, error) {
+	return t.conn.RequestMsgWithContext(ctx, msg)
+}
+
+// Connect to nats server of configs.Config.NatsURL
+func Connect(opts ...nats.Option) (*nats.Conn, error) {
+	return nats.Connect(configs.Config.NatsURL, opts...)
+}
@@ -0,0 +1,152 @@
+package pagination
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/tigapilarmandiri/perkakas/common/rds"
+	"github.com/tigapilarmandiri/perkakas/common/util"
+	"gorm.io/gorm"
+)
+
+// CountStrategy is how TotalRows is counted
+type CountStrategy string
+
+const (
+	// CountExact run COUNT(*) with the filter, it's the default
+	CountExact CountStrategy = "exact"
+	// CountEstimate use reltuples of the table from postgres statistic,
+	// the filter and other conditions are ignored so exact count is used when filter is not empty
+	CountEstimate CountStrategy = "estimate"
+	// CountCapped count until Option.CountCap rows, TotalRows is the cap when there are more rows
+	CountCapped CountStrategy = "capped"
+	// CountCached use exact count that is cached in redis for Option.CountTTL
+	CountCached CountStrategy = "cached"
+)
+
+const (
+	defaultCountCap = 10000
+	defaultCountTTL = time.Minute
+)
+
+func (p *Pagination) getCountCap() int64 {
+	if p.Option.CountCap <= 0 {
+		p.Option.CountCap = defaultCountCap
+	}
+	return p.Option.CountCap
+}
+
+func (p *Pagination) getCountTTL() time.Duration {
+	if p.Option.CountTTL <= 0 {
+		p.Option.CountTTL = defaultCountTTL
+	}
+	return p.Option.CountTTL
+}
+
+// count return total rows and set Option.CountedBy with the strategy that is actually used
+func (p *Pagination) count(query string, args []any) (totalRows int64, err error) {
+	db := p.DBConn
+	if query != "" {
+		db = db.Where(query, args...)
+	}
+
+	switch p.Option.CountStrategy {
+	case CountEstimate:
+		if query == "" && p.tableName != "" {
+			if totalRows, err = p.estimateCount(); err != nil {
+				return
+			}
+			// table that never analyzed has no statistic
+			if totalRows >= 0 {
+				p.Option.CountedBy = CountEstimate
+				return
+			}
+		}
+	case CountCapped:
+		return p.cappedCount(db)
+	case CountCached:
+		if p.tableName != "" {
+			return p.cachedCount(db)
+		}
+	}
+
+	p.Option.CountedBy = CountExact
+	err = db.Count(&totalRows).Error
+
+	return
+}
+
+func (p *Pagination) estimateCount() (totalRows int64, err error) {
+	totalRows = -1
+	err = p.DBConn.Session(&gorm.Session{NewDB: true}).
+		Raw("SELECT reltuples::bigint FROM pg_class WHERE oid = to_regclass(?)", p.tableName).
+		Find(&totalRows).Error
+
+	return
+}
+
+// cappedCount run count on subquery with limit, ex: SELECT count(*) FROM (SELECT 1 FROM users LIMIT 10001) capped
+func (p *Pagination) cappedCount(db *gorm.DB) (totalRows int64, err error) {
+	countCap := p.getCountCap()
+
+	sub := db.Select("1").Limit(int(countCap) + 1)
+	err = p.DBConn.Session(&gorm.Session{NewDB: true}).Table("(?) capped", sub).Count(&totalRows).Error
+	if err != nil {
+		return
+	}
+
+	p.Option.CountedBy = CountExact
+	if totalRows > countCap {
+		totalRows = countCap
+		p.Option.CountedBy = CountCapped
+	}
+
+	return
+}
+
+// cachedCount get count from redis, the count is stored when it's not found.
+// redis error is logged and exact count is returned
+func (p *Pagination) cachedCount(db *gorm.DB) (totalRows int64, err error) {
+	if p.Redis == nil {
+		p.Redis = rds.GetClient()
+	}
+
+	ctx := db.Statement.Context
+	key := countCacheKey(p.tableName, db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Count(&totalRows)
+	}))
+
+	val, err := p.Redis.Get(ctx, key).Result()
+	if err == nil {
+		if totalRows, err = strconv.ParseInt(val, 10, 64); err == nil {
+			p.Option.CountedBy = CountCached
+			return
+		}
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		util.Log.Error().Msg(err.Error())
+	}
+
+	p.Option.CountedBy = CountExact
+	if err = db.Count(&totalRows).Error; err != nil {
+		return
+	}
+
+	if err := p.Redis.Set(ctx, key, totalRows, p.getCountTTL()).Err(); err != nil {
+		util.Log.Error().Msg(err.Error())
+	}
+
+	return
+}
+
+// countCacheKey is keyed by table and hash of the count sql,
+// the sql contain the normalized filter and other conditions of the db (ex: soft delete)
+func countCacheKey(tableName, countSQL string) string {
+	sum := sha256.Sum256([]byte(countSQL))
+
+	return fmt.Sprintf("pagination:count:%s:%x", tableName, sum)
+}
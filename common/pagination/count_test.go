@@ -0,0 +1,123 @@
+package pagination
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tigapilarmandiri/perkakas/common/rds/rdstest"
+	"gorm.io/gorm"
+)
+
+// recordSQL collect sql of query callback on dry run db
+func recordSQL(t *testing.T, db *gorm.DB) *[]string {
+	var sqls []string
+	record := func(db *gorm.DB) {
+		sqls = append(sqls, db.Statement.SQL.String())
+	}
+
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:record", record))
+
+	return &sqls
+}
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name      string
+		option    Option
+		expected  string
+		countedBy CountStrategy
+	}{
+		{
+			name:      "default",
+			option:    Option{},
+			expected:  `SELECT count(*) FROM "test_models"`,
+			countedBy: CountExact,
+		},
+		{
+			name:      "estimate",
+			option:    Option{CountStrategy: CountEstimate},
+			expected:  `SELECT reltuples::bigint FROM pg_class WHERE oid = to_regclass($1)`,
+			countedBy: CountExact,
+		},
+		{
+			name:      "estimate with filter",
+			option:    Option{CountStrategy: CountEstimate, Filter: "umur:gt:17"},
+			expected:  `SELECT count(*) FROM "test_models" WHERE test_models.umur > $1`,
+			countedBy: CountExact,
+		},
+		{
+			name:      "capped",
+			option:    Option{CountStrategy: CountCapped, CountCap: 100, Filter: "umur:gt:17"},
+			expected:  `SELECT count(*) FROM (SELECT 1 FROM "test_models" WHERE test_models.umur > $1 LIMIT 101) capped`,
+			countedBy: CountExact,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			db := dryRunDB(t)
+			sqls := recordSQL(t, db)
+
+			p := Pagination{
+				Model:  testModel{},
+				Option: &tt.option,
+				DBConn: db,
+			}
+
+			var results []testModel
+			require.NoError(t, db.Model(testModel{}).Scopes(p.Paginate()).Find(&results).Error)
+			require.Contains(t, *sqls, tt.expected)
+			require.Equal(t, tt.countedBy, p.Option.CountedBy)
+		})
+	}
+}
+
+func TestCountCached(t *testing.T) {
+	db := dryRunDB(t)
+	sqls := recordSQL(t, db)
+	r := rdstest.New()
+
+	paginate := func(filter string) *Pagination {
+		p := &Pagination{
+			Model:  testModel{},
+			Option: &Option{CountStrategy: CountCached, Filter: filter},
+			DBConn: db,
+			Redis:  r,
+		}
+
+		var results []testModel
+		require.NoError(t, db.Model(testModel{}).Scopes(p.Paginate()).Find(&results).Error)
+
+		return p
+	}
+
+	// the count sql is built once for the cache key, the second one is the actual count
+	countSQL := `SELECT count(*) FROM "test_models" WHERE test_models.umur > $1`
+	countQuery := func() (n int) {
+		for _, v := range *sqls {
+			if v == countSQL {
+				n++
+			}
+		}
+		return
+	}
+
+	p := paginate("umur:gt:17")
+	require.Equal(t, CountExact, p.Option.CountedBy)
+	require.Equal(t, 2, countQuery())
+	require.Len(t, r.Data, 1)
+	for _, ttl := range r.TTL {
+		require.Equal(t, time.Minute, ttl)
+	}
+
+	*sqls = nil
+	p = paginate("umur:gt:17")
+	require.Equal(t, CountCached, p.Option.CountedBy)
+	require.Equal(t, 1, countQuery())
+
+	// different filter value has different key
+	p = paginate("umur:gt:18")
+	require.Equal(t, CountExact, p.Option.CountedBy)
+	require.Len(t, r.Data, 2)
+}
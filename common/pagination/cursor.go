@@ -0,0 +1,267 @@
+package pagination
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/tigapilarmandiri/perkakas/configs"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	errCursorNoPrimaryKey = errors.New("cursor pagination need model with primary key")
+	errCursorDestination  = errors.New("cursor destination must be pointer to slice")
+	errCursorNulls        = errors.New("nulls order or nullable sort column is not supported on cursor pagination")
+)
+
+// cursor is the payload of opaque cursor, it contain values of the sort columns
+// from the first (prev) or the last (next) row of a page
+type cursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+	Prev   bool              `json:"p,omitempty"`
+}
+
+func (p *Pagination) isCursorMode() bool {
+	return p.Option.CursorMode || p.Option.Cursor != ""
+}
+
+// cursorColumns return sort columns with primary key as tie breaker
+func (p *Pagination) cursorColumns(columns []sortColumn) ([]sortColumn, error) {
+	if p.schema == nil || p.schema.PrioritizedPrimaryField == nil {
+		return nil, errCursorNoPrimaryKey
+	}
+
+	pk := p.schema.PrioritizedPrimaryField
+	hasPK := false
+	for _, c := range columns {
+		// keyset condition can't compare null value
+		if c.nulls != "" || nullable(c.field) {
+			return nil, errCursorNulls
+		}
+		hasPK = hasPK || c.field == pk
+	}
+
+	if !hasPK {
+		columns = append(columns, sortColumn{field: pk})
+	}
+
+	return columns, nil
+}
+
+// nullable return true when the column can be null, it's pointer or sql.Null* (struct with Valid)
+// that is not tagged with gorm:"not null"
+func nullable(field *schema.Field) bool {
+	if field.NotNull || field.PrimaryKey {
+		return false
+	}
+
+	typ := field.FieldType
+	switch typ.Kind() {
+	case reflect.Pointer:
+		return true
+	case reflect.Struct:
+		valid, ok := typ.FieldByName("Valid")
+		return ok && valid.Type.Kind() == reflect.Bool
+	}
+
+	return false
+}
+
+func (p *Pagination) cursorScope(query string, args []any, columns []sortColumn) func(db *gorm.DB) *gorm.DB {
+	var err error
+	p.columns, err = p.cursorColumns(columns)
+	if err != nil {
+		return errorScope(err)
+	}
+
+	var values []any
+	p.cursor = nil
+	if p.Option.Cursor != "" {
+		p.cursor, values, err = p.decodeCursor(p.Option.Cursor)
+		if err != nil {
+			return errorScope(err)
+		}
+	}
+
+	prev := p.cursor != nil && p.cursor.Prev
+
+	return func(db *gorm.DB) *gorm.DB {
+		if query != "" {
+			db = db.Where(query, args...)
+		}
+
+		if values != nil {
+			q, a := keysetCondition(p.tableName, p.columns, values, prev)
+			db = db.Where(q, a...)
+		}
+
+		// prev page is fetched on reversed order, BuildCursor will reverse it back
+		for _, c := range p.columns {
+			db = db.Order(c.order(p.tableName, prev))
+		}
+
+		// fetch one more row to know if there is more data
+		return db.Limit(p.getLimit() + 1)
+	}
+}
+
+// keysetCondition build condition for rows after (or before when prev is true) the values
+// ex: (a > ?) OR (a = ? AND id > ?)
+func keysetCondition(tableName string, columns []sortColumn, values []any, prev bool) (string, []any) {
+	var args []any
+	ors := make([]string, 0, len(columns))
+
+	for i, c := range columns {
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, tableName+"."+columns[j].field.DBName+" = ?")
+			args = append(args, values[j])
+		}
+
+		op := " > ?"
+		if c.desc != prev {
+			op = " < ?"
+		}
+		ands = append(ands, tableName+"."+c.field.DBName+op)
+		args = append(args, values[i])
+
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+
+	return strings.Join(ors, " OR "), args
+}
+
+// BuildCursor set Option.NextCursor and Option.PrevCursor from result of the query,
+// dest is pointer to slice that used on Find.
+// the extra row fetched by Paginate is removed from dest
+func (p *Pagination) BuildCursor(dest any) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Slice {
+		return errCursorDestination
+	}
+	slice := rv.Elem()
+
+	hasMore := slice.Len() > p.getLimit()
+	if hasMore {
+		slice.Set(slice.Slice(0, p.getLimit()))
+	}
+
+	prev := p.cursor != nil && p.cursor.Prev
+	if prev {
+		swap := reflect.Swapper(slice.Interface())
+		for i, j := 0, slice.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	p.Option.NextCursor = ""
+	p.Option.PrevCursor = ""
+	if slice.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if hasMore || prev {
+		p.Option.NextCursor, err = p.encodeCursor(slice.Index(slice.Len()-1), false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.cursor != nil && (hasMore || !prev) {
+		p.Option.PrevCursor, err = p.encodeCursor(slice.Index(0), true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Pagination) encodeCursor(row reflect.Value, prev bool) (string, error) {
+	row = reflect.Indirect(row)
+
+	c := cursor{Sort: p.Option.Sort, Prev: prev}
+	for _, col := range p.columns {
+		v, _ := col.field.ValueOf(context.Background(), row)
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		c.Values = append(c.Values, b)
+	}
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signCursor(payload)), nil
+}
+
+// decodeCursor verify the signature and convert cursor values to type of the sort columns
+func (p *Pagination) decodeCursor(token string) (*cursor, []any, error) {
+	arrs := strings.Split(token, ".")
+	if len(arrs) != 2 {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(arrs[0])
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(arrs[1])
+	if err != nil || !hmac.Equal(sig, signCursor(payload)) {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err = json.Unmarshal(payload, &c); err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	// cursor is only valid for the same sort
+	if c.Sort != p.Option.Sort || len(c.Values) != len(p.columns) {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	values := make([]any, 0, len(c.Values))
+	for i, col := range p.columns {
+		// the sort columns is not null, see cursorColumns
+		if string(c.Values[i]) == "null" {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		typ := col.field.FieldType
+		for typ.Kind() == reflect.Pointer {
+			typ = typ.Elem()
+		}
+
+		v := reflect.New(typ)
+		if err = json.Unmarshal(c.Values[i], v.Interface()); err != nil {
+			return nil, nil, ErrInvalidCursor
+		}
+		values = append(values, v.Elem().Interface())
+	}
+
+	return &c, values, nil
+}
+
+func signCursor(payload []byte) []byte {
+	sig := hmac.New(sha256.New, []byte(configs.Config.CursorKey))
+	sig.Write(payload)
+
+	return sig.Sum(nil)
+}
@@ -0,0 +1,170 @@
+package pagination
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testModels(from, to int) []testModel {
+	var results []testModel
+	for i := from; i <= to; i++ {
+		results = append(results, testModel{ID: strconv.Itoa(i), Umur: i, Nama: "nama " + strconv.Itoa(i)})
+	}
+
+	return results
+}
+
+func TestCursor(t *testing.T) {
+	db := dryRunDB(t)
+
+	// first page
+	p := Pagination{
+		Model:  testModel{},
+		Option: &Option{Limit: 2, Sort: "umur desc", CursorMode: true, SkipCount: true},
+		DBConn: db,
+	}
+
+	var results []testModel
+	stmt := db.Model(testModel{}).Scopes(p.Paginate()).Find(&results).Statement
+	require.NoError(t, stmt.Error)
+	require.Equal(t, `SELECT * FROM "test_models" ORDER BY test_models.umur DESC,test_models.id ASC LIMIT 3`, stmt.SQL.String())
+
+	results = testModels(1, 3)
+	require.NoError(t, p.BuildCursor(&results))
+	require.Equal(t, testModels(1, 2), results)
+	require.NotEmpty(t, p.Option.NextCursor)
+	require.Empty(t, p.Option.PrevCursor)
+
+	// next page
+	p = Pagination{
+		Model:  testModel{},
+		Option: &Option{Limit: 2, Sort: "umur desc", Filter: "umur:gt:0", Cursor: p.Option.NextCursor},
+		DBConn: db,
+	}
+
+	stmt = db.Model(testModel{}).Scopes(p.Paginate()).Find(&results).Statement
+	require.NoError(t, stmt.Error)
+	require.Equal(t, `SELECT * FROM "test_models" WHERE test_models.umur > $1 AND ((test_models.umur < $2) OR (test_models.umur = $3 AND test_models.id > $4)) ORDER BY test_models.umur DESC,test_models.id ASC LIMIT 3`, stmt.SQL.String())
+	require.Equal(t, []any{0, 2, 2, "2"}, stmt.Vars)
+
+	results = testModels(3, 4)
+	require.NoError(t, p.BuildCursor(&results))
+	require.Equal(t, testModels(3, 4), results)
+	require.Empty(t, p.Option.NextCursor)
+	require.NotEmpty(t, p.Option.PrevCursor)
+
+	// prev page is fetched on reversed order
+	p = Pagination{
+		Model:  testModel{},
+		Option: &Option{Limit: 2, Sort: "umur desc", Cursor: p.Option.PrevCursor, SkipCount: true},
+		DBConn: db,
+	}
+
+	stmt = db.Model(testModel{}).Scopes(p.Paginate()).Find(&results).Statement
+	require.NoError(t, stmt.Error)
+	require.Equal(t, `SELECT * FROM "test_models" WHERE (test_models.umur > $1) OR (test_models.umur = $2 AND test_models.id < $3) ORDER BY test_models.umur ASC,test_models.id DESC LIMIT 3`, stmt.SQL.String())
+	require.Equal(t, []any{3, 3, "3"}, stmt.Vars)
+
+	results = []testModel{testModels(2, 2)[0], testModels(1, 1)[0]}
+	require.NoError(t, p.BuildCursor(&results))
+	require.Equal(t, testModels(1, 2), results)
+	require.NotEmpty(t, p.Option.NextCursor)
+	require.Empty(t, p.Option.PrevCursor)
+}
+
+func TestCursorInvalid(t *testing.T) {
+	db := dryRunDB(t)
+
+	p := Pagination{
+		Model:  testModel{},
+		Option: &Option{Limit: 1, Sort: "umur desc", CursorMode: true},
+		DBConn: db,
+	}
+
+	var results []testModel
+	require.NoError(t, db.Model(testModel{}).Scopes(p.Paginate()).Find(&results).Error)
+
+	results = testModels(1, 2)
+	require.NoError(t, p.BuildCursor(&results))
+	next := p.Option.NextCursor
+
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+	}{
+		{"tampered", "umur desc", next[:len(next)-2] + "xx"},
+		{"not signed", "umur desc", next[:len(next)-10]},
+		{"random", "umur desc", "abc"},
+		{"other sort", "nama desc", next},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p := Pagination{
+				Model:  testModel{},
+				Option: &Option{Limit: 1, Sort: tt.sort, Cursor: tt.cursor},
+				DBConn: db,
+			}
+
+			err := db.Model(testModel{}).Scopes(p.Paginate()).Find(&results).Error
+			require.ErrorIs(t, err, ErrInvalidCursor)
+		})
+	}
+
+	require.ErrorIs(t, p.BuildCursor(results), errCursorDestination)
+}
+
+func TestCursorNulls(t *testing.T) {
+	db := dryRunDB(t)
+
+	p := Pagination{
+		Model:  testModel{},
+		Option: &Option{Sort: "created_at desc nulls last", CursorMode: true, SkipCount: true},
+		DBConn: db,
+	}
+
+	var results []testModel
+	err := db.Model(testModel{}).Scopes(p.Paginate()).Find(&results).Error
+	require.ErrorIs(t, err, errCursorNulls)
+}
+
+type nullableModel struct {
+	ID        string         `sort:"id"`
+	Nama      sql.NullString `sort:"nama"`
+	Umur      *int           `gorm:"not null" sort:"umur"`
+	CreatedAt *time.Time     `sort:"created_at"`
+}
+
+func TestCursorNullable(t *testing.T) {
+	db := dryRunDB(t)
+
+	find := func(sort, cursor string) error {
+		p := Pagination{
+			Model:  nullableModel{},
+			Option: &Option{Sort: sort, CursorMode: true, Cursor: cursor, SkipCount: true},
+			DBConn: db,
+		}
+
+		var results []nullableModel
+		return db.Model(nullableModel{}).Scopes(p.Paginate()).Find(&results).Error
+	}
+
+	// null row is never matched by the keyset condition
+	require.ErrorIs(t, find("created_at desc", ""), errCursorNulls)
+	require.ErrorIs(t, find("nama", ""), errCursorNulls)
+	require.NoError(t, find("umur", ""))
+
+	// cursor of a row with null value
+	payload, err := json.Marshal(cursor{Sort: "umur", Values: []json.RawMessage{json.RawMessage("null"), json.RawMessage(`"1"`)}})
+	require.NoError(t, err)
+	token := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signCursor(payload))
+	require.ErrorIs(t, find("umur", token), ErrInvalidCursor)
+}
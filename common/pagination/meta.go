@@ -0,0 +1,71 @@
+package pagination
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tigapilarmandiri/perkakas/common/http_response"
+	"github.com/tigapilarmandiri/perkakas/common/util"
+	"github.com/tigapilarmandiri/perkakas/proto"
+)
+
+// MaxLimit is the biggest Option.Limit that is accepted by Validate
+var MaxLimit = 100
+
+func init() {
+	http_response.RegisterError(ErrInvalidSort, http.StatusBadRequest)
+	http_response.RegisterError(ErrInvalidCursor, http.StatusBadRequest)
+	http_response.RegisterError(errCursorNulls, http.StatusBadRequest)
+}
+
+// Validate check page and limit from client, zero value will use the default
+func (o *Option) Validate() error {
+	if o.Page < 0 {
+		return fmt.Errorf("%w: page must not be negative", util.ErrValidation)
+	}
+
+	if o.Limit < 0 || o.Limit > MaxLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d, or 0 for the default", util.ErrValidation, MaxLimit)
+	}
+
+	return nil
+}
+
+// HttpMeta convert the option into meta of http response
+func (o Option) HttpMeta() *http_response.Meta {
+	return &http_response.Meta{
+		Page:       o.Page,
+		Limit:      o.Limit,
+		TotalPage:  o.TotalPages,
+		TotalData:  int(o.TotalRows),
+		NextCursor: o.NextCursor,
+		PrevCursor: o.PrevCursor,
+
+		CountStrategy: string(o.CountedBy),
+	}
+}
+
+// ProtoMeta convert the option into meta of nats response
+func (o Option) ProtoMeta() *proto.ResponseMeta {
+	return o.HttpMeta().ToProto()
+}
+
+// OptionFromProto convert meta of nats request into option
+func OptionFromProto(meta *proto.RequestMeta) Option {
+	return Option{
+		Page:   int(meta.GetPage()),
+		Limit:  int(meta.GetLimit()),
+		Filter: meta.GetFilter(),
+		Sort:   meta.GetSort(),
+	}
+}
+
+// RequestMeta convert the option into meta of nats request
+func (o Option) RequestMeta() *proto.RequestMeta {
+	return &proto.RequestMeta{
+		Page:   int32(o.Page),
+		Limit:  int32(o.Limit),
+		Filter: o.Filter,
+		Sort:   o.Sort,
+	}
+}
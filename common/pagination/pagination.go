@@ -4,8 +4,10 @@ import (
 	"math"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/tigapilarmandiri/perkakas"
+	"github.com/tigapilarmandiri/perkakas/common/rds"
 	"github.com/tigapilarmandiri/perkakas/common/util"
 	"gorm.io/gorm"
 	"gorm.io/gorm/schema"
@@ -15,16 +17,40 @@ type Pagination struct {
 	Model     any
 	Option    *Option
 	DBConn    *gorm.DB
+	Redis     rds.Rediser // used by CountCached, default is rds.GetClient()
 	tableName string
+	schema    *schema.Schema
+	columns   []sortColumn
+	cursor    *cursor
 }
 
 type Option struct {
 	Limit      int
 	Page       int
-	Sort       string
+	Sort       string // comma separated column with optional direction and nulls order, ex: jenis asc,nama desc nulls last
 	Filter     string
 	TotalRows  int64
 	TotalPages int
+
+	// SkipCount skip the COUNT(*) query, TotalRows and TotalPages will be 0
+	SkipCount bool
+
+	// CountStrategy is how TotalRows is counted, default is CountExact
+	CountStrategy CountStrategy
+	// CountCap is max rows that is counted by CountCapped, default is 10000
+	CountCap int64
+	// CountTTL is how long the count is cached by CountCached, default is 1 minute
+	CountTTL time.Duration
+	// CountedBy is the strategy that is used to count TotalRows,
+	// ex: CountCapped means there are more rows than TotalRows
+	CountedBy CountStrategy
+
+	// Cursor is opaque cursor from client (NextCursor or PrevCursor of previous page),
+	// keyset pagination is used when Cursor is not empty or CursorMode is true
+	Cursor     string
+	CursorMode bool
+	NextCursor string
+	PrevCursor string
 }
 
 func (p *Pagination) getOffset() int {
@@ -45,26 +71,14 @@ func (p *Pagination) getPage() int {
 	return p.Option.Page
 }
 
-func (p *Pagination) getSort() string {
-	if IsSortSave(p.Option.Sort) {
-		return p.tableName + "." + p.Option.Sort
-	}
-	return p.tableName + ".Id ASC"
-}
-
-func (p *Pagination) Paginate() func(db *gorm.DB) *gorm.DB {
-	var totalRows int64
-	var err error
-	var args []any
-	var query string
-
+// prepare parse the model and build filter query and sort columns from the option
+func (p *Pagination) prepare() (query string, args []any, columns []sortColumn, err error) {
 	if p.Model != nil {
-		var s *schema.Schema
-		s, err = schema.Parse(p.Model, &sync.Map{}, schema.NamingStrategy{})
+		p.schema, err = schema.Parse(p.Model, &sync.Map{}, schema.NamingStrategy{})
 		if err != nil {
-			return nil
+			return
 		}
-		p.tableName = s.Table
+		p.tableName = p.schema.Table
 	}
 
 	if p.DBConn.Statement.Model == nil && p.DBConn.Statement.Table == "" {
@@ -72,28 +86,92 @@ func (p *Pagination) Paginate() func(db *gorm.DB) *gorm.DB {
 	}
 	if !perkakas.IsEmpty(p.Option.Filter) {
 		query, args, err = util.BuildFilterQuery(p.Model, p.Option.Filter)
-		if err == nil {
-			p.DBConn.Where(query, args...).Count(&totalRows)
-		} else {
-			p.DBConn.Count(&totalRows)
+		if err != nil {
+			return
 		}
-	} else {
-		p.DBConn.Count(&totalRows)
 	}
 
-	p.Option.TotalRows = totalRows
-	totalPages := int(math.Ceil(float64(totalRows) / float64(p.Option.Limit)))
-	p.Option.TotalPages = totalPages
+	columns, err = p.sortColumns()
+
+	return
+}
+
+// Paginate return scope for gorm,
+// invalid filter (*util.FilterError) is added to the db error instead of being ignored
+// invalid sort (ErrInvalidSort) is added to the db error too, only field with sort tag can be sorted
+// on cursor mode, call BuildCursor with the query result to get next and prev cursor
+func (p *Pagination) Paginate() func(db *gorm.DB) *gorm.DB {
+	query, args, columns, err := p.prepare()
+	if err != nil {
+		return errorScope(err)
+	}
+
+	if !p.Option.SkipCount {
+		var totalRows int64
+		if totalRows, err = p.count(query, args); err != nil {
+			return errorScope(err)
+		}
+
+		p.Option.TotalRows = totalRows
+		totalPages := int(math.Ceil(float64(totalRows) / float64(p.getLimit())))
+		p.Option.TotalPages = totalPages
+	}
+
+	if p.isCursorMode() {
+		return p.cursorScope(query, args, columns)
+	}
+
+	p.columns = columns
+	order := p.getSort()
 
 	return func(db *gorm.DB) *gorm.DB {
-		if !perkakas.IsEmpty(p.Option.Filter) && err == nil {
+		if query != "" {
 			db = db.Where(query, args...)
 		}
 
-		return db.Offset(p.getOffset()).Limit(p.getLimit()).Order(p.getSort())
+		db = db.Offset(p.getOffset()).Limit(p.getLimit())
+		if order != "" {
+			db = db.Order(order)
+		}
+
+		return db
+	}
+}
+
+// Query return scope that only apply filter and sort of the option without limit and count,
+// it's used to export all rows, ex: with http_response.SendRows
+func (p *Pagination) Query() func(db *gorm.DB) *gorm.DB {
+	query, args, columns, err := p.prepare()
+	if err != nil {
+		return errorScope(err)
+	}
+
+	p.columns = columns
+	order := p.getSort()
+
+	return func(db *gorm.DB) *gorm.DB {
+		if query != "" {
+			db = db.Where(query, args...)
+		}
+
+		if order != "" {
+			db = db.Order(order)
+		}
+
+		return db
+	}
+}
+
+func errorScope(err error) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db.AddError(err)
+		return db
 	}
 }
 
+// IsSortSave check the sort is a column name with optional asc or desc
+//
+// Deprecated: use the sort tag of the model, Paginate validate the sort against it
 func IsSortSave(payload string) bool {
 	if len(payload) > 30 || len(payload) == 0 {
 		return false
@@ -1,6 +1,15 @@
 package pagination
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tigapilarmandiri/perkakas/common/http_response"
+	"github.com/tigapilarmandiri/perkakas/common/util"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
 
 func TestIsSortSave(t *testing.T) {
 	tests := []struct {
@@ -33,3 +42,133 @@ func TestIsSortSave(t *testing.T) {
 		})
 	}
 }
+
+type testModel struct {
+	ID        string     `sort:"id"`
+	Umur      int        `filter:"umur" sort:"umur"`
+	Nama      string     `filter:"nama" sort:"nama"`
+	Password  string     `filter:"-"`
+	CreatedAt *time.Time `sort:"created_at"`
+}
+
+// dryRunDB is gorm.DB that only build the sql without connecting to database
+func dryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestPaginate(t *testing.T) {
+	db := dryRunDB(t)
+
+	p := Pagination{
+		Model:  testModel{},
+		Option: &Option{Filter: "umur:gte:17", Sort: "nama desc"},
+		DBConn: db,
+	}
+
+	var results []testModel
+	stmt := db.Model(testModel{}).Scopes(p.Paginate()).Find(&results).Statement
+
+	require.NoError(t, stmt.Error)
+	require.Equal(t, `SELECT * FROM "test_models" WHERE test_models.umur >= $1 ORDER BY test_models.nama DESC LIMIT 10`, stmt.SQL.String())
+	require.Equal(t, []any{17}, stmt.Vars)
+	require.Equal(t, 10, p.Option.Limit)
+	require.Equal(t, 1, p.Option.Page)
+}
+
+func TestPaginateFilterError(t *testing.T) {
+	db := dryRunDB(t)
+
+	p := Pagination{
+		Model:  testModel{},
+		Option: &Option{Filter: "umur:gte:abc"},
+		DBConn: db,
+	}
+
+	var results []testModel
+	err := db.Model(testModel{}).Scopes(p.Paginate()).Find(&results).Error
+
+	var fe *util.FilterError
+	require.ErrorAs(t, err, &fe)
+	require.Equal(t, "umur:gte:abc", fe.Fragment)
+	require.Equal(t, "umur", fe.Field)
+}
+
+func TestPaginateSort(t *testing.T) {
+	tests := []struct {
+		name     string
+		sort     string
+		expected string
+		err      string
+	}{
+		{"default", "", "ORDER BY test_models.id ASC", ""},
+		{"single", "Nama", "ORDER BY test_models.nama ASC", ""},
+		{"multi", "umur asc,nama desc,created_at desc", "ORDER BY test_models.umur ASC,test_models.nama DESC,test_models.created_at DESC", ""},
+		{"nulls", "created_at desc nulls last, nama nulls first", "ORDER BY test_models.created_at DESC NULLS LAST,test_models.nama ASC NULLS FIRST", ""},
+		{"not in whitelist", "password desc", "", "invalid sort: sort is not allowed for 'password'"},
+		{"unknown", "alamat", "", "invalid sort: sort is not allowed for 'alamat'"},
+		{"SQLi", "nama; drop table users;", "", "invalid sort: sort is not allowed for 'nama;'"},
+		{"typo", "nama ascc", "", "invalid sort: invalid sort for 'nama'"},
+		{"invalid nulls", "nama desc nulls", "", "invalid sort: invalid sort for 'nama'"},
+		{"duplicate", "nama,nama desc", "", "invalid sort: duplicate sort for 'nama'"},
+		{"empty column", "nama,", "", "invalid sort: empty sort column"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			db := dryRunDB(t)
+
+			p := Pagination{
+				Model:  testModel{},
+				Option: &Option{Sort: tt.sort, SkipCount: true},
+				DBConn: db,
+			}
+
+			var results []testModel
+			stmt := db.Model(testModel{}).Scopes(p.Paginate()).Find(&results).Statement
+			if tt.err != "" {
+				require.ErrorIs(t, stmt.Error, ErrInvalidSort)
+				require.EqualError(t, stmt.Error, tt.err)
+				return
+			}
+
+			require.NoError(t, stmt.Error)
+			require.Equal(t, `SELECT * FROM "test_models" `+tt.expected+` LIMIT 10`, stmt.SQL.String())
+		})
+	}
+}
+
+func TestOptionProto(t *testing.T) {
+	opt := Option{Page: 2, Limit: 25, Filter: "umur:gte:17;AND;nama:like:budi", Sort: "nama desc,umur"}
+	require.Equal(t, opt, OptionFromProto(opt.RequestMeta()))
+
+	require.Equal(t, Option{}, OptionFromProto(nil))
+
+	opt = Option{Page: 2, Limit: 25, TotalRows: 60, TotalPages: 3, NextCursor: "next", CountedBy: CountCapped}
+	meta := opt.ProtoMeta()
+	require.EqualValues(t, 25, meta.Limit)
+	require.Equal(t, opt.HttpMeta(), http_response.MetaFromProto(meta))
+}
+
+func TestOptionValidate(t *testing.T) {
+	for _, opt := range []Option{{}, {Page: 1, Limit: 1}, {Page: 3, Limit: MaxLimit}} {
+		require.NoError(t, opt.Validate())
+	}
+
+	err := (&Option{Page: -1}).Validate()
+	require.ErrorIs(t, err, util.ErrValidation)
+	require.ErrorContains(t, err, "page must not be negative")
+
+	for _, limit := range []int{-1, MaxLimit + 1} {
+		err = (&Option{Limit: limit}).Validate()
+		require.ErrorIs(t, err, util.ErrValidation)
+		require.ErrorContains(t, err, "limit must be between 1 and 100, or 0 for the default")
+	}
+}
@@ -0,0 +1,120 @@
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+var ErrInvalidSort = errors.New("invalid sort")
+
+type sortColumn struct {
+	field *schema.Field
+	desc  bool
+	// FIRST or LAST, empty means database default
+	nulls string
+}
+
+func (c sortColumn) order(tableName string, reverse bool) string {
+	dir := "ASC"
+	if c.desc != reverse {
+		dir = "DESC"
+	}
+
+	order := tableName + "." + c.field.DBName + " " + dir
+	if c.nulls != "" {
+		order += " NULLS " + c.nulls
+	}
+
+	return order
+}
+
+// sortFields return fields that have sort tag, keyed by the tag
+// only these fields can be used on Option.Sort, ex: `sort:"nama"`
+func sortFields(s *schema.Schema) map[string]*schema.Field {
+	fields := make(map[string]*schema.Field)
+	for _, f := range s.Fields {
+		tag := strings.ToLower(f.Tag.Get("sort"))
+		// avoid if sort is empty or field equal "-"
+		if len(tag) > 0 && tag != "-" && f.DBName != "" {
+			fields[tag] = f
+		}
+	}
+
+	return fields
+}
+
+// sortColumns parse Option.Sort into sort columns,
+// the format is comma separated column with optional direction and nulls order
+// ex: jenis asc,nama desc nulls last,created_at desc
+func (p *Pagination) sortColumns() ([]sortColumn, error) {
+	if strings.TrimSpace(p.Option.Sort) == "" {
+		return nil, nil
+	}
+
+	if p.schema == nil {
+		return nil, fmt.Errorf("%w: sort need model", ErrInvalidSort)
+	}
+
+	fields := sortFields(p.schema)
+	used := make(map[string]bool)
+
+	var columns []sortColumn
+	for _, part := range strings.Split(p.Option.Sort, ",") {
+		words := strings.Fields(strings.ToLower(part))
+		if len(words) == 0 {
+			return nil, fmt.Errorf("%w: empty sort column", ErrInvalidSort)
+		}
+
+		name := words[0]
+		f, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: sort is not allowed for '%s'", ErrInvalidSort, name)
+		}
+		if used[name] {
+			return nil, fmt.Errorf("%w: duplicate sort for '%s'", ErrInvalidSort, name)
+		}
+		used[name] = true
+
+		c := sortColumn{field: f}
+		words = words[1:]
+
+		if len(words) > 0 && (words[0] == "asc" || words[0] == "desc") {
+			c.desc = words[0] == "desc"
+			words = words[1:]
+		}
+
+		if len(words) == 2 && words[0] == "nulls" && (words[1] == "first" || words[1] == "last") {
+			c.nulls = strings.ToUpper(words[1])
+			words = words[2:]
+		}
+
+		if len(words) > 0 {
+			return nil, fmt.Errorf("%w: invalid sort for '%s'", ErrInvalidSort, name)
+		}
+
+		columns = append(columns, c)
+	}
+
+	return columns, nil
+}
+
+// getSort return order by clause, primary key is used when sort is empty
+func (p *Pagination) getSort() string {
+	if len(p.columns) == 0 {
+		if p.schema == nil || p.schema.PrioritizedPrimaryField == nil {
+			return ""
+		}
+
+		return sortColumn{field: p.schema.PrioritizedPrimaryField}.order(p.tableName, false)
+	}
+
+	orders := make([]string, 0, len(p.columns))
+	for _, c := range p.columns {
+		orders = append(orders, c.order(p.tableName, false))
+	}
+
+	return strings.Join(orders, ",")
+}
@@ -0,0 +1,313 @@
+// Package rdstest is in memory rds.Rediser for test
+package rdstest
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/tigapilarmandiri/perkakas/common/rds"
+)
+
+// Redis is in memory rds.Rediser, only the commands that is used by perkakas is implemented.
+// the expiration is stored in TTL but the key is never expired
+type Redis struct {
+	rds.Rediser
+	mu sync.Mutex
+
+	Data  map[string]string
+	TTL   map[string]time.Duration
+	ZSets map[string]map[string]float64
+
+	// Err is returned by every command when it's set, ex: redis is down
+	Err error
+}
+
+func New() *Redis {
+	return &Redis{Data: map[string]string{}, TTL: map[string]time.Duration{}, ZSets: map[string]map[string]float64{}}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) *redis.StringCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := redis.NewStringCmd(ctx, "get", key)
+	if r.Err != nil {
+		cmd.SetErr(r.Err)
+		return cmd
+	}
+
+	v, ok := r.Data[key]
+	if !ok {
+		cmd.SetErr(redis.Nil)
+	}
+	cmd.SetVal(v)
+
+	return cmd
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := redis.NewStatusCmd(ctx, "set", key, value)
+	if r.Err != nil {
+		cmd.SetErr(r.Err)
+		return cmd
+	}
+
+	r.set(key, value, expiration)
+
+	return cmd
+}
+
+func (r *Redis) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	return r.setIf(ctx, key, value, expiration, false)
+}
+
+func (r *Redis) SetXX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	return r.setIf(ctx, key, value, expiration, true)
+}
+
+// setIf set the key when its existence is exist
+func (r *Redis) setIf(ctx context.Context, key string, value interface{}, expiration time.Duration, exist bool) *redis.BoolCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := redis.NewBoolCmd(ctx, "set", key, value)
+	if r.Err != nil {
+		cmd.SetErr(r.Err)
+		return cmd
+	}
+
+	if _, ok := r.Data[key]; ok == exist {
+		r.set(key, value, expiration)
+		cmd.SetVal(true)
+	}
+
+	return cmd
+}
+
+func (r *Redis) set(key string, value interface{}, expiration time.Duration) {
+	r.Data[key] = fmt.Sprint(value)
+	r.TTL[key] = expiration
+}
+
+func (r *Redis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := redis.NewIntCmd(ctx, "del")
+	if r.Err != nil {
+		cmd.SetErr(r.Err)
+		return cmd
+	}
+
+	var n int64
+	for _, key := range keys {
+		_, ok := r.Data[key]
+		_, zok := r.ZSets[key]
+		if ok || zok {
+			n++
+		}
+		delete(r.Data, key)
+		delete(r.ZSets, key)
+		delete(r.TTL, key)
+	}
+	cmd.SetVal(n)
+
+	return cmd
+}
+
+func (r *Redis) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := redis.NewIntCmd(ctx, "exists")
+	if r.Err != nil {
+		cmd.SetErr(r.Err)
+		return cmd
+	}
+
+	var n int64
+	for _, key := range keys {
+		if _, ok := r.Data[key]; ok {
+			n++
+		}
+	}
+	cmd.SetVal(n)
+
+	return cmd
+}
+
+func (r *Redis) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := redis.NewBoolCmd(ctx, "expire", key)
+	if r.Err != nil {
+		cmd.SetErr(r.Err)
+		return cmd
+	}
+
+	r.TTL[key] = expiration
+	cmd.SetVal(true)
+
+	return cmd
+}
+
+// Scan return every matched key at once
+func (r *Redis) Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := redis.NewScanCmd(ctx, nil, "scan", cursor, "match", match, "count", count)
+	if r.Err != nil {
+		cmd.SetErr(r.Err)
+		return cmd
+	}
+
+	var keys []string
+	for key := range r.Data {
+		if ok, _ := path.Match(match, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	cmd.SetVal(keys, 0)
+
+	return cmd
+}
+
+func (r *Redis) ZAdd(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := redis.NewIntCmd(ctx, "zadd", key)
+	if r.Err != nil {
+		cmd.SetErr(r.Err)
+		return cmd
+	}
+
+	if r.ZSets[key] == nil {
+		r.ZSets[key] = map[string]float64{}
+	}
+	for _, m := range members {
+		r.ZSets[key][fmt.Sprint(m.Member)] = m.Score
+	}
+
+	return cmd
+}
+
+func (r *Redis) ZRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
+	return r.zrange(ctx, key, start, stop, false)
+}
+
+func (r *Redis) ZRevRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
+	return r.zrange(ctx, key, start, stop, true)
+}
+
+func (r *Redis) zrange(ctx context.Context, key string, start, stop int64, rev bool) *redis.StringSliceCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := redis.NewStringSliceCmd(ctx, "zrange", key, start, stop)
+	if r.Err != nil {
+		cmd.SetErr(r.Err)
+		return cmd
+	}
+
+	members := make([]string, 0, len(r.ZSets[key]))
+	for m := range r.ZSets[key] {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if rev {
+			i, j = j, i
+		}
+		return r.ZSets[key][members[i]] < r.ZSets[key][members[j]]
+	})
+
+	n := int64(len(members))
+	if stop < 0 || stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		members = nil
+	} else {
+		members = members[start : stop+1]
+	}
+	cmd.SetVal(members)
+
+	return cmd
+}
+
+func (r *Redis) ZCard(ctx context.Context, key string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := redis.NewIntCmd(ctx, "zcard", key)
+	if r.Err != nil {
+		cmd.SetErr(r.Err)
+		return cmd
+	}
+
+	cmd.SetVal(int64(len(r.ZSets[key])))
+
+	return cmd
+}
+
+func (r *Redis) ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := redis.NewIntCmd(ctx, "zrem", key)
+	if r.Err != nil {
+		cmd.SetErr(r.Err)
+		return cmd
+	}
+
+	for _, m := range members {
+		delete(r.ZSets[key], fmt.Sprint(m))
+	}
+
+	return cmd
+}
+
+// ZRemRangeByScore remove members within min and max, "-inf" and "+inf" is supported
+func (r *Redis) ZRemRangeByScore(ctx context.Context, key, min, max string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := redis.NewIntCmd(ctx, "zremrangebyscore", key, min, max)
+	if r.Err != nil {
+		cmd.SetErr(r.Err)
+		return cmd
+	}
+
+	minScore, err := strconv.ParseFloat(min, 64)
+	if err != nil {
+		cmd.SetErr(err)
+		return cmd
+	}
+	maxScore, err := strconv.ParseFloat(max, 64)
+	if err != nil {
+		cmd.SetErr(err)
+		return cmd
+	}
+
+	var n int64
+	for m, score := range r.ZSets[key] {
+		if score >= minScore && score <= maxScore {
+			delete(r.ZSets[key], m)
+			n++
+		}
+	}
+	cmd.SetVal(n)
+
+	return cmd
+}
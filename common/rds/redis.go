@@ -62,3 +62,40 @@ func GetClient() Rediser {
 	})
 	return rediser
 }
+
+type scanner interface {
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+}
+
+// Scan call fn with the keys that match the pattern, every master is scanned when rdb is cluster.
+// it's SCAN instead of KEYS so redis is not blocked, the keys can be deleted by fn
+func Scan(ctx context.Context, rdb Rediser, match string, count int64, fn func(keys []string) error) error {
+	if cluster, ok := rdb.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			return scan(ctx, master, match, count, fn)
+		})
+	}
+
+	return scan(ctx, rdb, match, count, fn)
+}
+
+func scan(ctx context.Context, rdb scanner, match string, count int64, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := rdb.Scan(ctx, cursor, match, count).Result()
+		if err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			if err = fn(keys); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
@@ -2,87 +2,512 @@ package sessions
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/redis/go-redis/v9"
+	"github.com/tigapilarmandiri/perkakas/common/middlewares/authenticator"
 	"github.com/tigapilarmandiri/perkakas/common/middlewares/authorization"
+	"github.com/tigapilarmandiri/perkakas/common/pagination"
 	"github.com/tigapilarmandiri/perkakas/common/rds"
 	"github.com/tigapilarmandiri/perkakas/common/util"
 	"github.com/tigapilarmandiri/perkakas/configs"
 )
 
+// value of configs.Config.Session.ClientCheck
+const (
+	// ClientCheckFlag log and flag the request in context when the client is changed, see ClientChanged
+	ClientCheckFlag = "flag"
+	// ClientCheckRefuse refuse the request when the client is changed
+	ClientCheckRefuse = "refuse"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrTokenNotActive  = errors.New("token is not the active token of the session")
+	ErrClientChanged   = errors.New("client of the session is changed")
+)
+
+// getClient is the redis of the sessions, it's replaced on test
+var getClient = rds.GetClient
+
+// genKey is key of the session before multi device, it's still read until it's expired
 var genKey = func(key string) string {
 	return fmt.Sprintf("s-%s", key)
 }
 
+// sessionKey is key of a session, user id is the hash tag so every key of the user is on the same cluster slot
+func sessionKey(userID, sessionID string) string {
+	return fmt.Sprintf("s-{%s}:%s", userID, sessionID)
+}
+
+// indexKey is sorted set of session id of the user, the score is the created time
+func indexKey(userID string) string {
+	return fmt.Sprintf("sessions-{%s}", userID)
+}
+
+// allIndexKey is sorted set of every session as "<user id>:<session id>", the score is the expired time
+// so the expired session can be removed by the score. it's used by GetAll and Clear
+// instead of KEYS that block redis and only see one node of the cluster
+const allIndexKey = "sessions-index"
+
+// indexAll add the session to allIndexKey, it's updated when the session is extended
+func indexAll(ctx context.Context, rdb rds.Rediser, session Session, expiredAt time.Time) error {
+	return rdb.ZAdd(ctx, allIndexKey, redis.Z{Score: float64(expiredAt.UnixNano()), Member: allIndexMember(session.UserID, session.ID)}).Err()
+}
+
+func allIndexMember(userID, sessionID string) string {
+	return userID + ":" + sessionID
+}
+
+func parseAllIndexMember(member string) (userID, sessionID string) {
+	if i := strings.LastIndex(member, ":"); i >= 0 {
+		return member[:i], member[i+1:]
+	}
+
+	return member, ""
+}
+
+// Session is a session of the user on a device, only hash of the token is stored
+// and UserInfo is the claims of the token that is shown by GetAll
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"userId"`
+	Device     string    `json:"device"`
+	TokenHash  string    `json:"tokenHash"`
+	UserInfo   UserInfo  `json:"userInfo"`
+	RemoteAddr string    `json:"remoteAddr"`
+	UserAgent  string    `json:"userAgent"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+}
+
+// storedSession is Session that is stored before the token is removed,
+// Token is only read to get the token hash and the user info
+type storedSession struct {
+	Session
+	Token string `json:"token"`
+}
+
+// Device is the client of a new session, Label is the name that is shown to the user, ex: "Chrome on Windows"
+type Device struct {
+	Label      string
+	RemoteAddr string
+	UserAgent  string
+}
+
+// HashToken return sha256 of the token that is stored as the active token of the session
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// ID return session id of the token
+func ID(token string) string {
+	return HashToken(token)[:32]
+}
+
+// absoluteTimeout is max lifetime of the session since it's created
+func absoluteTimeout() time.Duration {
+	if timeout := configs.Config.Session.AbsoluteTimeout; timeout > 0 {
+		return time.Duration(timeout) * time.Second
+	}
+
+	if configs.Config.IsProduction() {
+		return 24 * time.Hour
+	}
+
+	return 24 * time.Hour * 7
+}
+
+// touchInterval is min interval of Touch, it's at most half of the idle timeout
+// so the active session is extended before it's expired
+func touchInterval() time.Duration {
+	interval := time.Duration(configs.Config.Session.TouchInterval) * time.Second
+	if idle := time.Duration(configs.Config.Session.IdleTimeout) * time.Second; idle > 0 && interval > idle/2 {
+		return idle / 2
+	}
+
+	return interval
+}
+
+// ttl of the session at now, it's the remaining absolute lifetime or the idle timeout when it's shorter
+func ttl(session Session, now time.Time) time.Duration {
+	exp := session.CreatedAt.Add(absoluteTimeout()).Sub(now)
+
+	if idle := time.Duration(configs.Config.Session.IdleTimeout) * time.Second; idle > 0 && idle < exp {
+		return idle
+	}
+
+	return exp
+}
+
+// Store create session of the token, the device label is the user agent
 func Store(ctx context.Context, token, remoteAddr, userAgent string) (err error) {
+	_, err = Create(ctx, token, Device{Label: userAgent, RemoteAddr: remoteAddr, UserAgent: userAgent})
+	return
+}
+
+// Create create session of the token on the device, the oldest session is evicted
+// when the user has more than configs.Config.Session.MaxPerUser sessions
+func Create(ctx context.Context, token string, device Device) (session Session, err error) {
 	var claim authorization.Claims
 	claim, err = claimAuthToken(token)
 	if err != nil {
 		return
 	}
 
-	exp := time.Now().Add(24 * time.Hour * 7)
-	if configs.Config.IsProduction() {
-		exp = time.Now().Add(24 * time.Hour)
+	now := time.Now()
+	session = Session{
+		ID:         ID(token),
+		UserID:     claim.UserUUID,
+		Device:     device.Label,
+		TokenHash:  HashToken(token),
+		UserInfo:   userInfo(claim),
+		RemoteAddr: device.RemoteAddr,
+		UserAgent:  device.UserAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
 	}
 
-	/* Remove old session first */
-	err = Delete(ctx, claim.UserUUID)
+	var payload []byte
+	payload, err = json.Marshal(session)
 	if err != nil {
 		return
 	}
 
-	data := map[string]interface{}{
-		"token":      token,
-		"remoteAddr": remoteAddr,
-		"userAgent":  userAgent,
+	rdb := getClient()
+
+	// session that is stored before multi device
+	if err = rdb.Del(ctx, genKey(session.UserID)).Err(); err != nil {
+		return
 	}
 
-	var payload []byte
-	payload, err = json.Marshal(data)
+	exp := ttl(session, now)
+	if err = rdb.Set(ctx, sessionKey(session.UserID, session.ID), string(payload), exp).Err(); err != nil {
+		return
+	}
+
+	index := indexKey(session.UserID)
+	if err = rdb.ZAdd(ctx, index, redis.Z{Score: float64(now.UnixNano()), Member: session.ID}).Err(); err != nil {
+		return
+	}
+
+	// the index is kept as long as the newest session can live
+	if err = rdb.Expire(ctx, index, absoluteTimeout()).Err(); err != nil {
+		return
+	}
+
+	if err = indexAll(ctx, rdb, session, now.Add(exp)); err != nil {
+		return
+	}
+
+	_, err = EvictOldest(ctx, session.UserID, configs.Config.Session.MaxPerUser)
+
+	return
+}
+
+// Get return session of the user, ErrSessionNotFound when it's not found or expired
+func Get(ctx context.Context, userID, sessionID string) (session Session, err error) {
+	return get(ctx, sessionKey(userID, sessionID))
+}
+
+func get(ctx context.Context, key string) (session Session, err error) {
+	var payload string
+	payload, err = getClient().Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		err = ErrSessionNotFound
+		return
+	}
 	if err != nil {
 		return
 	}
 
-	/* Set new sessions */
-	err = rds.GetClient().Set(ctx, genKey(claim.UserUUID), string(payload), time.Until(exp)).Err()
+	var stored storedSession
+	if err = json.Unmarshal([]byte(payload), &stored); err != nil {
+		return
+	}
+
+	session = stored.Session
+	if stored.Token != "" {
+		if session.TokenHash == "" {
+			session.TokenHash = HashToken(stored.Token)
+		}
+		if session.UserInfo.UserID == "" {
+			if claim, err := claimAuthToken(stored.Token); err == nil {
+				session.UserInfo = userInfo(claim)
+			}
+		}
+	}
 
 	return
 }
 
-func IsExist(ctx context.Context, userID string) (ok bool, err error) {
+// List return the active sessions of the user from the oldest,
+// expired session is removed from the index
+func List(ctx context.Context, userID string) (sessions []Session, err error) {
+	rdb := getClient()
+	index := indexKey(userID)
 
-	var val int64
-	val, err = rds.GetClient().Exists(ctx, genKey(userID)).Result()
+	var ids []string
+	ids, err = rdb.ZRange(ctx, index, 0, -1).Result()
 	if err != nil {
 		return
 	}
 
-	ok = val == 1
+	var expired, expiredAll []any
+	for _, id := range ids {
+		session, err := Get(ctx, userID, id)
+		if errors.Is(err, ErrSessionNotFound) {
+			expired = append(expired, id)
+			expiredAll = append(expiredAll, allIndexMember(userID, id))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if len(expired) > 0 {
+		if err = rdb.ZRem(ctx, index, expired...).Err(); err != nil {
+			return
+		}
+		err = rdb.ZRem(ctx, allIndexKey, expiredAll...).Err()
+	}
 
 	return
 }
 
-func Delete(ctx context.Context, userID string) (err error) {
-	err = rds.GetClient().Del(ctx, genKey(userID)).Err()
+// Revoke delete a session of the user
+func Revoke(ctx context.Context, userID, sessionID string) (err error) {
+	rdb := getClient()
+	if err = rdb.Del(ctx, sessionKey(userID, sessionID)).Err(); err != nil {
+		return
+	}
+
+	if err = rdb.ZRem(ctx, indexKey(userID), sessionID).Err(); err != nil {
+		return
+	}
+
+	err = rdb.ZRem(ctx, allIndexKey, allIndexMember(userID, sessionID)).Err()
+
 	return
 }
 
-func Clear(ctx context.Context, exclude ...string) (err error) {
-	cmd := rds.GetClient().Keys(ctx, "*")
+// RevokeOthers delete every session of the user except the current session, ex: "logout other devices".
+// current session id of the request is CurrentID
+func RevokeOthers(ctx context.Context, userID, currentID string) (err error) {
+	var sessions []Session
+	sessions, err = List(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	for _, session := range sessions {
+		if session.ID == currentID {
+			continue
+		}
+
+		if err = Revoke(ctx, userID, session.ID); err != nil {
+			return
+		}
+	}
+
+	return getClient().Del(ctx, genKey(userID)).Err()
+}
+
+// EvictOldest revoke the oldest sessions of the user until there is limit sessions,
+// limit <= 0 means unlimited. it return id of the evicted sessions
+func EvictOldest(ctx context.Context, userID string, limit int) (evicted []string, err error) {
+	if limit <= 0 {
+		return
+	}
+
+	var sessions []Session
+	sessions, err = List(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < len(sessions)-limit; i++ {
+		if err = Revoke(ctx, userID, sessions[i].ID); err != nil {
+			return
+		}
+		evicted = append(evicted, sessions[i].ID)
+	}
+
+	return
+}
+
+// IsExist return true when the user has a session
+func IsExist(ctx context.Context, userID string) (ok bool, err error) {
+	var val int64
+	val, err = getClient().Exists(ctx, genKey(userID)).Result()
+	if err != nil || val == 1 {
+		ok = val == 1
+		return
+	}
+
+	var sessions []Session
+	sessions, err = List(ctx, userID)
+	ok = len(sessions) > 0
+
+	return
+}
+
+// Validate check the token has an active session, so revoked or evicted token can't be used.
+// remote address and user agent is compared based on configs.Config.Session.ClientCheck,
+// changed is the changed field (remote_addr or user_agent) when it's flagged.
+// empty remoteAddr or userAgent is not compared, ex: rpc request
+func Validate(ctx context.Context, userID, token, remoteAddr, userAgent string) (session Session, changed []string, err error) {
+	legacy := false
+	session, err = Get(ctx, userID, ID(token))
+	if errors.Is(err, ErrSessionNotFound) {
+		// session that is stored before multi device
+		session, err = get(ctx, genKey(userID))
+		legacy = true
+	}
+	if err != nil {
+		return
+	}
 
-	if cmd.Err() != nil {
-		err = cmd.Err()
+	if subtle.ConstantTimeCompare([]byte(session.TokenHash), []byte(HashToken(token))) != 1 {
+		err = ErrTokenNotActive
 		return
 	}
 
-	isExcluded := func(key string) bool {
+	// move it to the new session, so it's listed and indexed
+	if legacy {
+		session, err = Create(ctx, token, Device{Label: session.UserAgent, RemoteAddr: session.RemoteAddr, UserAgent: session.UserAgent})
+		if err != nil {
+			return
+		}
+	}
+
+	check := configs.Config.Session.ClientCheck
+	if check != ClientCheckFlag && check != ClientCheckRefuse {
+		return
+	}
+
+	if remoteAddr != "" && session.RemoteAddr != "" && host(remoteAddr) != host(session.RemoteAddr) {
+		changed = append(changed, "remote_addr")
+	}
+
+	if userAgent != "" && session.UserAgent != "" && userAgent != session.UserAgent {
+		changed = append(changed, "user_agent")
+	}
+
+	if len(changed) > 0 && check == ClientCheckRefuse {
+		err = fmt.Errorf("%w: %s", ErrClientChanged, strings.Join(changed, ", "))
+	}
+
+	return
+}
+
+// Touch update the last seen of the session and extend it by the idle timeout,
+// it's skipped when the last seen is within configs.Config.Session.TouchInterval so it's cheap for every request.
+// ErrSessionNotFound is returned when the absolute lifetime is passed or it's revoked
+func Touch(ctx context.Context, session Session) (Session, error) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < touchInterval() {
+		return session, nil
+	}
+
+	exp := ttl(session, now)
+	if exp <= 0 {
+		return session, ErrSessionNotFound
+	}
+
+	session.LastSeenAt = now
+
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return session, err
+	}
+
+	rdb := getClient()
+
+	// XX so revoked session is not stored again
+	ok, err := rdb.SetXX(ctx, sessionKey(session.UserID, session.ID), string(payload), exp).Result()
+	if err != nil {
+		return session, err
+	}
+	if !ok {
+		return session, ErrSessionNotFound
+	}
+
+	return session, indexAll(ctx, rdb, session, now.Add(exp))
+}
+
+// ClientChanged return the changed client field of flagged request
+func ClientChanged(ctx context.Context) []string {
+	changed, _ := ctx.Value(util.ContextKey(util.ContextSessionChanged)).([]string)
+	return changed
+}
+
+// CurrentID return session id of the authenticated request
+func CurrentID(ctx context.Context) string {
+	id, _ := ctx.Value(util.ContextKey(util.ContextSessionID)).(string)
+	return id
+}
+
+// host remove port of the address, the port is different on every connection
+func host(addr string) string {
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		return h
+	}
+
+	return addr
+}
+
+// Delete delete every session of the user
+func Delete(ctx context.Context, userID string) (err error) {
+	rdb := getClient()
+
+	var ids []string
+	ids, err = rdb.ZRange(ctx, indexKey(userID), 0, -1).Result()
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		if err = Revoke(ctx, userID, id); err != nil {
+			return
+		}
+	}
+
+	// the keys is on different slot of the cluster
+	for _, key := range []string{genKey(userID), indexKey(userID)} {
+		if err = rdb.Del(ctx, key).Err(); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// clearBatch is number of index member that is read at once by Clear
+const clearBatch = 100
+
+// Clear delete every session except session of the excluded users,
+// session that is stored before multi device is not indexed so it's deleted with SCAN
+func Clear(ctx context.Context, exclude ...string) (err error) {
+	rdb := getClient()
+
+	isExcluded := func(userID string) bool {
 		for _, v := range exclude {
-			if strings.HasSuffix(key, v) {
+			if strings.HasSuffix(userID, v) {
 				return true
 			}
 		}
@@ -90,68 +515,147 @@ func Clear(ctx context.Context, exclude ...string) (err error) {
 		return false
 	}
 
-	for _, item := range cmd.Val() {
-		if isExcluded(item) {
-			continue
+	// revoked session is removed from the index, so start only move after the excluded session
+	var start int64
+	for {
+		var members []string
+		members, err = rdb.ZRange(ctx, allIndexKey, start, start+clearBatch-1).Result()
+		if err != nil {
+			return
+		}
+		if len(members) == 0 {
+			break
 		}
 
-		if strings.HasPrefix(item, "s-") {
-			err = rds.GetClient().Del(ctx, item).Err()
-			if err != nil {
+		for _, member := range members {
+			userID, sessionID := parseAllIndexMember(member)
+			if isExcluded(userID) {
+				start++
 				continue
 			}
+
+			if err = Revoke(ctx, userID, sessionID); err != nil {
+				return
+			}
 		}
 	}
 
-	return
+	legacyPrefix := genKey("")
+	return rds.Scan(ctx, rdb, legacyPrefix+"*", clearBatch, func(keys []string) error {
+		for _, key := range keys {
+			userID := strings.TrimPrefix(key, legacyPrefix)
+			// s-{user id}:session id is the indexed session
+			if strings.HasPrefix(userID, "{") || isExcluded(userID) {
+				continue
+			}
+
+			if err := rdb.Del(ctx, key).Err(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
-func GetAll(ctx context.Context) (sessions []map[string]interface{}, err error) {
-	cmd := rds.GetClient().Keys(ctx, "*")
+// SessionInfo is a session with the user info of the token
+type SessionInfo struct {
+	SessionID  string    `json:"session_id"`
+	UserInfo   UserInfo  `json:"user_info"`
+	Device     string    `json:"device"`
+	RemoteAddr string    `json:"remote_addr"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// UserInfo is the claims of the token of the session
+type UserInfo struct {
+	UserID          string `json:"user_id"`
+	Username        string `json:"username"`
+	Name            string `json:"name"`
+	KepolisianUUID  string `json:"kepolisian_uuid"`
+	KepolisianLevel string `json:"kepolisian_level"`
+}
 
-	if cmd.Err() != nil {
-		err = cmd.Err()
+// GetAll return a page of every session from the latest expired time (the last used), page and limit is from opt
+// and TotalRows and TotalPages is set. expired session is removed from the index before it's counted
+func GetAll(ctx context.Context, opt *pagination.Option) (sessions []SessionInfo, err error) {
+	if err = opt.Validate(); err != nil {
 		return
 	}
+	if opt.Page == 0 {
+		opt.Page = 1
+	}
+	if opt.Limit == 0 {
+		opt.Limit = 10
+	}
 
-	for _, item := range cmd.Val() {
-		if strings.HasPrefix(item, "s-") {
-			payload := rds.GetClient().Get(ctx, item).Val()
+	rdb := getClient()
 
-			var sessionInfo map[string]interface{}
-			if err = json.Unmarshal([]byte(payload), &sessionInfo); err != nil {
-				return
-			}
+	if err = rdb.ZRemRangeByScore(ctx, allIndexKey, "-inf", strconv.FormatInt(time.Now().UnixNano(), 10)).Err(); err != nil {
+		return
+	}
 
-			if claim, err := claimAuthToken(sessionInfo["token"].(string)); err == nil {
-				sessions = append(sessions, map[string]interface{}{
-					"user_info": map[string]interface{}{
-						"user_id":          claim.UserUUID,
-						"username":         claim.UserName,
-						"name":             claim.Name,
-						"kepolisian_uuid":  claim.KepolisianUUID,
-						"kepolisian_level": claim.KepolisianLevel,
-					},
-					"remote_addr": sessionInfo["remoteAddr"],
-					"user_agent":  sessionInfo["userAgent"],
-				})
-			}
+	opt.TotalRows, err = rdb.ZCard(ctx, allIndexKey).Result()
+	if err != nil {
+		return
+	}
+	opt.TotalPages = int((opt.TotalRows + int64(opt.Limit) - 1) / int64(opt.Limit))
+
+	start := int64((opt.Page - 1) * opt.Limit)
 
+	var members []string
+	members, err = rdb.ZRevRange(ctx, allIndexKey, start, start+int64(opt.Limit)-1).Result()
+	if err != nil {
+		return
+	}
+
+	sessions = []SessionInfo{}
+	for _, member := range members {
+		userID, sessionID := parseAllIndexMember(member)
+
+		session, err := Get(ctx, userID, sessionID)
+		if errors.Is(err, ErrSessionNotFound) {
+			if err = Revoke(ctx, userID, sessionID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
 		}
+
+		sessions = append(sessions, SessionInfo{
+			SessionID:  session.ID,
+			UserInfo:   session.UserInfo,
+			Device:     session.Device,
+			RemoteAddr: session.RemoteAddr,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+		})
 	}
 
 	return
 }
 
+func userInfo(claim authorization.Claims) UserInfo {
+	return UserInfo{
+		UserID:          claim.UserUUID,
+		Username:        claim.UserName,
+		Name:            claim.Name,
+		KepolisianUUID:  claim.KepolisianUUID,
+		KepolisianLevel: claim.KepolisianLevel,
+	}
+}
+
+// claimAuthToken return the claims of the token when the session is created
 func claimAuthToken(authToken string) (claim authorization.Claims, err error) {
 	var token *jwt.Token
-	token, err = jwt.Parse(authToken, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method :%v", token.Header["alg"])
-		}
-
-		return []byte(configs.Config.JWT.SecretKey), nil
-	})
+	token, err = jwt.Parse(authToken, authenticator.Keys(func() (string, string, string) {
+		return configs.Config.JWT.DateKey, configs.Config.JWT.SecretKey, configs.Config.JWT.JWKS
+	}).JWTKey)
 
 	if err != nil {
 		util.Log.Error().Msg(err.Error())
@@ -159,7 +663,7 @@ func claimAuthToken(authToken string) (claim authorization.Claims, err error) {
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
-	if !(ok || token.Valid) {
+	if !ok || !token.Valid {
 		err = fmt.Errorf("token is invalid")
 
 		util.Log.Error().Msg(err.Error())
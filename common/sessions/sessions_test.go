@@ -0,0 +1,325 @@
+package sessions
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/tigapilarmandiri/perkakas/common/pagination"
+	"github.com/tigapilarmandiri/perkakas/common/rds"
+	"github.com/tigapilarmandiri/perkakas/common/rds/rdstest"
+	"github.com/tigapilarmandiri/perkakas/configs"
+)
+
+func newTestRedis(t *testing.T) *rdstest.Redis {
+	r := rdstest.New()
+
+	old := getClient
+	getClient = func() rds.Rediser { return r }
+	t.Cleanup(func() { getClient = old })
+
+	return r
+}
+
+func newToken(t *testing.T, userID string, n int) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_uuid": userID, "created": n}).
+		SignedString([]byte(configs.Config.JWT.SecretKey))
+	require.NoError(t, err)
+
+	return token
+}
+
+func setConfig(t *testing.T, session configs.Session) {
+	jwtConfig, sessionConfig := configs.Config.JWT, configs.Config.Session
+	configs.Config.JWT.SecretKey, configs.Config.JWT.JWKS = "secretKey", ""
+	configs.Config.Session = session
+	t.Cleanup(func() { configs.Config.JWT, configs.Config.Session = jwtConfig, sessionConfig })
+}
+
+func TestMultiDevice(t *testing.T) {
+	rdb := newTestRedis(t)
+	setConfig(t, configs.Session{MaxPerUser: 2})
+	ctx := context.Background()
+
+	phone, laptop, tablet := newToken(t, "user-1", 1), newToken(t, "user-1", 2), newToken(t, "user-1", 3)
+
+	sPhone, err := Create(ctx, phone, Device{Label: "phone", RemoteAddr: "10.0.0.1:1234", UserAgent: "android"})
+	require.NoError(t, err)
+	require.Equal(t, ID(phone), sPhone.ID)
+	require.Equal(t, "user-1", sPhone.UserID)
+	require.Equal(t, absoluteTimeout(), rdb.TTL[sessionKey("user-1", sPhone.ID)])
+
+	_, err = Create(ctx, laptop, Device{Label: "laptop"})
+	require.NoError(t, err)
+
+	list, err := List(ctx, "user-1")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, "phone", list[0].Device)
+	require.Equal(t, "laptop", list[1].Device)
+
+	// the phone is evicted
+	_, err = Create(ctx, tablet, Device{Label: "tablet"})
+	require.NoError(t, err)
+
+	_, _, err = Validate(ctx, "user-1", phone, "", "")
+	require.ErrorIs(t, err, ErrSessionNotFound)
+
+	session, _, err := Validate(ctx, "user-1", laptop, "", "")
+	require.NoError(t, err)
+	require.Equal(t, "laptop", session.Device)
+
+	// logout other devices
+	require.NoError(t, RevokeOthers(ctx, "user-1", ID(tablet)))
+	list, err = List(ctx, "user-1")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, "tablet", list[0].Device)
+
+	require.NoError(t, Revoke(ctx, "user-1", ID(tablet)))
+	ok, err := IsExist(ctx, "user-1")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestEvictOldest(t *testing.T) {
+	newTestRedis(t)
+	setConfig(t, configs.Session{MaxPerUser: 0})
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		_, err := Create(ctx, newToken(t, "user-1", i), Device{})
+		require.NoError(t, err)
+	}
+
+	list, err := List(ctx, "user-1")
+	require.NoError(t, err)
+	require.Len(t, list, 5)
+
+	evicted, err := EvictOldest(ctx, "user-1", 3)
+	require.NoError(t, err)
+	require.Equal(t, []string{list[0].ID, list[1].ID}, evicted)
+
+	// expired session is removed from the index
+	rdb := getClient().(*rdstest.Redis)
+	delete(rdb.Data, sessionKey("user-1", list[2].ID))
+	list, err = List(ctx, "user-1")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Len(t, rdb.ZSets[indexKey("user-1")], 2)
+}
+
+func TestValidate(t *testing.T) {
+	rdb := newTestRedis(t)
+	setConfig(t, configs.Session{MaxPerUser: 1, ClientCheck: ClientCheckFlag})
+	ctx := context.Background()
+
+	token := newToken(t, "user-1", 1)
+	created, err := Create(ctx, token, Device{RemoteAddr: "10.0.0.1:1234", UserAgent: "android"})
+	require.NoError(t, err)
+	// only the hash of the token is stored
+	require.NotContains(t, rdb.Data[sessionKey("user-1", created.ID)], token)
+	require.Equal(t, "user-1", created.UserInfo.UserID)
+
+	// other port of the same host
+	_, changed, err := Validate(ctx, "user-1", token, "10.0.0.1:5678", "android")
+	require.NoError(t, err)
+	require.Empty(t, changed)
+
+	_, changed, err = Validate(ctx, "user-1", token, "10.0.0.2:5678", "ios")
+	require.NoError(t, err)
+	require.Equal(t, []string{"remote_addr", "user_agent"}, changed)
+
+	configs.Config.Session.ClientCheck = ClientCheckRefuse
+	_, _, err = Validate(ctx, "user-1", token, "10.0.0.2:5678", "android")
+	require.ErrorIs(t, err, ErrClientChanged)
+
+	// login again with limit 1 revoke the older token
+	_, err = Create(ctx, newToken(t, "user-1", 2), Device{})
+	require.NoError(t, err)
+	_, _, err = Validate(ctx, "user-1", token, "", "")
+	require.ErrorIs(t, err, ErrSessionNotFound)
+
+	// session that is stored before multi device
+	legacy := newToken(t, "user-2", 1)
+	rdb.Data[genKey("user-2")] = `{"token":"` + legacy + `","remoteAddr":"10.0.0.1","userAgent":"android"}`
+	_, _, err = Validate(ctx, "user-2", newToken(t, "user-2", 2), "", "")
+	require.ErrorIs(t, err, ErrTokenNotActive)
+
+	// it's moved to the new session on the first use
+	session, _, err := Validate(ctx, "user-2", legacy, "", "")
+	require.NoError(t, err)
+	require.Equal(t, ID(legacy), session.ID)
+	require.NotContains(t, rdb.Data, genKey("user-2"))
+	require.Contains(t, rdb.ZSets[allIndexKey], allIndexMember("user-2", session.ID))
+}
+
+func TestTouch(t *testing.T) {
+	rdb := newTestRedis(t)
+	setConfig(t, configs.Session{AbsoluteTimeout: 3600, IdleTimeout: 600, TouchInterval: 60})
+	ctx := context.Background()
+
+	session, err := Create(ctx, newToken(t, "user-1", 1), Device{})
+	require.NoError(t, err)
+	key := sessionKey("user-1", session.ID)
+	require.Equal(t, 10*time.Minute, rdb.TTL[key])
+
+	// it's touched at most once per the interval
+	rdb.TTL[key] = 0
+	touched, err := Touch(ctx, session)
+	require.NoError(t, err)
+	require.Equal(t, session.LastSeenAt, touched.LastSeenAt)
+	require.Zero(t, rdb.TTL[key])
+
+	session.LastSeenAt = session.LastSeenAt.Add(-2 * time.Minute)
+	touched, err = Touch(ctx, session)
+	require.NoError(t, err)
+	require.True(t, touched.LastSeenAt.After(session.LastSeenAt))
+	require.Equal(t, 10*time.Minute, rdb.TTL[key])
+
+	stored, err := Get(ctx, "user-1", session.ID)
+	require.NoError(t, err)
+	require.True(t, stored.LastSeenAt.Equal(touched.LastSeenAt))
+
+	// the idle timeout can't extend the absolute lifetime
+	session.CreatedAt = time.Now().Add(-55 * time.Minute)
+	touched, err = Touch(ctx, session)
+	require.NoError(t, err)
+	require.InDelta(t, 5*time.Minute, rdb.TTL[key], float64(time.Second))
+
+	session.CreatedAt = time.Now().Add(-2 * time.Hour)
+	_, err = Touch(ctx, session)
+	require.ErrorIs(t, err, ErrSessionNotFound)
+
+	// revoked session is not stored again
+	touched.CreatedAt = time.Now()
+	touched.LastSeenAt = touched.LastSeenAt.Add(-2 * time.Minute)
+	require.NoError(t, Revoke(ctx, "user-1", session.ID))
+	_, err = Touch(ctx, touched)
+	require.ErrorIs(t, err, ErrSessionNotFound)
+	require.NotContains(t, rdb.Data, key)
+}
+
+func TestTouchInterval(t *testing.T) {
+	rdb := newTestRedis(t)
+	// the default interval is longer than the idle timeout
+	setConfig(t, configs.Session{AbsoluteTimeout: 3600, IdleTimeout: 30, TouchInterval: 60})
+	ctx := context.Background()
+	require.Equal(t, 15*time.Second, touchInterval())
+
+	session, err := Create(ctx, newToken(t, "user-1", 1), Device{})
+	require.NoError(t, err)
+	key := sessionKey("user-1", session.ID)
+
+	// the active session is extended before it's expired by the idle timeout
+	rdb.TTL[key] = 0
+	session.LastSeenAt = session.LastSeenAt.Add(-20 * time.Second)
+	_, err = Touch(ctx, session)
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Second, rdb.TTL[key])
+
+	// the interval that is just below the idle timeout
+	configs.Config.Session.IdleTimeout, configs.Config.Session.TouchInterval = 1800, 1740
+	require.Equal(t, 15*time.Minute, touchInterval())
+
+	configs.Config.Session.TouchInterval = 600
+	require.Equal(t, 10*time.Minute, touchInterval())
+
+	configs.Config.Session.IdleTimeout = 0
+	require.Equal(t, 10*time.Minute, touchInterval())
+}
+
+func TestGetAll(t *testing.T) {
+	rdb := newTestRedis(t)
+	setConfig(t, configs.Session{MaxPerUser: 0})
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		_, err := Create(ctx, newToken(t, "user-1", i), Device{Label: strconv.Itoa(i)})
+		require.NoError(t, err)
+	}
+
+	opt := &pagination.Option{Page: 1, Limit: 2}
+	all, err := GetAll(ctx, opt)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), opt.TotalRows)
+	require.Equal(t, 3, opt.TotalPages)
+	// the newest first
+	require.Len(t, all, 2)
+	require.Equal(t, "4", all[0].Device)
+	require.Equal(t, "user-1", all[0].UserInfo.UserID)
+
+	all0 := all[1].SessionID
+
+	// session that is stored with the token before only its hash is stored
+	old := newToken(t, "user-2", 1)
+	rdb.Data[sessionKey("user-2", ID(old))] = `{"id":"` + ID(old) + `","userId":"user-2","device":"5","token":"` + old + `"}`
+	rdb.ZSets[allIndexKey][allIndexMember("user-2", ID(old))] = float64(time.Now().Add(30 * 24 * time.Hour).UnixNano())
+	all, err = GetAll(ctx, &pagination.Option{Page: 1, Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, "user-2", all[0].UserInfo.UserID)
+	session, _, err := Validate(ctx, "user-2", old, "", "")
+	require.NoError(t, err)
+	require.Equal(t, HashToken(old), session.TokenHash)
+	require.NoError(t, Revoke(ctx, "user-2", ID(old)))
+
+	opt = &pagination.Option{Page: 3, Limit: 2}
+	all, err = GetAll(ctx, opt)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	require.Equal(t, "0", all[0].Device)
+
+	// expired session is removed from the index
+	delete(rdb.Data, sessionKey("user-1", all[0].SessionID))
+	all, err = GetAll(ctx, opt)
+	require.NoError(t, err)
+	require.Empty(t, all)
+	require.Len(t, rdb.ZSets[allIndexKey], 4)
+
+	// index member is removed by the expired time before it's counted
+	rdb.ZSets[allIndexKey][allIndexMember("user-1", all0)] = float64(time.Now().Add(-time.Second).UnixNano())
+	opt = &pagination.Option{Page: 1, Limit: 2}
+	all, err = GetAll(ctx, opt)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), opt.TotalRows)
+	require.Equal(t, 2, opt.TotalPages)
+	require.Len(t, rdb.ZSets[allIndexKey], 3)
+
+	_, err = GetAll(ctx, &pagination.Option{Limit: 1000})
+	require.Error(t, err)
+}
+
+func TestClear(t *testing.T) {
+	rdb := newTestRedis(t)
+	setConfig(t, configs.Session{MaxPerUser: 0})
+	ctx := context.Background()
+
+	for _, user := range []string{"user-1", "user-2", "user-3"} {
+		for i := 0; i < clearBatch; i++ {
+			_, err := Create(ctx, newToken(t, user, i), Device{})
+			require.NoError(t, err)
+		}
+	}
+
+	// session that is stored before multi device
+	legacy, excludedLegacy := newToken(t, "user-4", 1), newToken(t, "user-2", clearBatch)
+	rdb.Data[genKey("user-4")] = `{"token":"` + legacy + `"}`
+	rdb.Data[genKey("user-2")] = `{"token":"` + excludedLegacy + `"}`
+
+	require.NoError(t, Clear(ctx, "user-2"))
+	for key := range rdb.Data {
+		require.Contains(t, key, "user-2")
+	}
+	require.Len(t, rdb.ZSets[allIndexKey], clearBatch)
+	require.Contains(t, rdb.Data, genKey("user-2"))
+
+	_, _, err := Validate(ctx, "user-4", legacy, "", "")
+	require.ErrorIs(t, err, ErrSessionNotFound)
+
+	list, err := List(ctx, "user-2")
+	require.NoError(t, err)
+	require.Len(t, list, clearBatch)
+}
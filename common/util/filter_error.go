@@ -0,0 +1,49 @@
+package util
+
+import (
+	"errors"
+)
+
+var (
+	errInvalidFilter     = errors.New("invalid query filter")
+	errInvalidClause     = errors.New("invalid clause")
+	errUnbalancedBracket = errors.New("unbalanced bracket in query filter")
+)
+
+// FilterError is returned by BuildFilterQuery when query filter from client is not valid
+type FilterError struct {
+	// Fragment is part of the filter that cause the error, ex: umur:eq:abc
+	Fragment string `json:"fragment"`
+	// Index is position of the fragment in the filter
+	Index    int    `json:"index"`
+	Field    string `json:"field,omitempty"`
+	Operator string `json:"operator,omitempty"`
+	Reason   string `json:"reason"`
+
+	Err error `json:"-"`
+}
+
+func newFilterError(fragment string, index int, err error) *FilterError {
+	return &FilterError{
+		Fragment: fragment,
+		Index:    index,
+		Reason:   err.Error(),
+		Err:      err,
+	}
+}
+
+func newConditionError(n *filterNode, err error) *FilterError {
+	fe := newFilterError(n.fragment(), n.offset, err)
+	fe.Field = n.field
+	fe.Operator = n.clause
+
+	return fe
+}
+
+func (e *FilterError) Error() string {
+	return e.Reason
+}
+
+func (e *FilterError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,142 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// number of values taken by clause operator
+const (
+	valueNone = 0
+	valueOne  = 1
+	valueTwo  = 2
+	// one or more values separated by comma
+	valueMany = -1
+)
+
+// fieldKind is group of struct field type, used to check
+// whether clause operator can be used on the field
+type fieldKind int
+
+const (
+	kindString fieldKind = 1 << iota
+	kindNumber
+	kindBool
+	kindTime
+	kindArray
+	kindJSON
+	// ex: uuid.UUID
+	kindOther
+
+	kindOrdered = kindString | kindNumber | kindTime
+	kindScalar  = kindOrdered | kindBool | kindOther
+	kindAny     = kindScalar | kindArray | kindJSON
+)
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+type clauseOperator struct {
+	query  string
+	values int
+	accept fieldKind
+}
+
+func classifyField(typ reflect.Type) fieldKind {
+	typ = indirectType(typ)
+
+	switch {
+	case typ == timeType:
+		return kindTime
+	case reflect.PtrTo(typ).Implements(textUnmarshalerType):
+		return kindOther
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return kindString
+	case reflect.Bool:
+		return kindBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return kindNumber
+	case reflect.Map:
+		return kindJSON
+	case reflect.Slice, reflect.Array:
+		// ex: json.RawMessage
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return kindJSON
+		}
+		return kindArray
+	case reflect.Struct:
+		if typ.Implements(jsonMarshalerType) {
+			return kindJSON
+		}
+	}
+
+	return kindOther
+}
+
+func (c clauseOperator) splitValues(clause, name, value string) ([]string, error) {
+	switch c.values {
+	case valueNone:
+		if value != "" {
+			return nil, fmt.Errorf("%w: clause '%s' doesn't need value for '%s'", ErrValidation, clause, name)
+		}
+		return nil, nil
+	case valueOne:
+		return []string{value}, nil
+	}
+
+	values := strings.Split(value, ",")
+	if c.values > 0 && len(values) != c.values {
+		return nil, fmt.Errorf("%w: clause '%s' need %d values for '%s'", ErrValidation, clause, c.values, name)
+	}
+
+	return values, nil
+}
+
+// arrayFilterValue validate values against element type of the array field
+// and return it as postgres array literal, ex: {"a","b"}
+func arrayFilterValue(name string, typ reflect.Type, values []string) (string, error) {
+	elem := indirectType(typ).Elem()
+
+	var b strings.Builder
+	b.WriteString("{")
+	for i, v := range values {
+		if _, err := coerceFilterValue(name, elem, v); err != nil {
+			return "", err
+		}
+
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(`"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`)
+	}
+	b.WriteString("}")
+
+	return b.String(), nil
+}
+
+// jsonFilterValue convert key=value pairs into json object,
+// the value is always compared as string
+func jsonFilterValue(name string, values []string) (string, error) {
+	obj := make(map[string]string, len(values))
+	for _, v := range values {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return "", invalidFilterValue(name, v)
+		}
+
+		obj[kv[0]] = kv[1]
+	}
+
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return "", invalidFilterValue(name, strings.Join(values, ","))
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,235 @@
+package util
+
+import (
+	"strings"
+)
+
+const (
+	filterAnd = "AND"
+	filterOr  = "OR"
+)
+
+var filterSeparators = []string{";" + filterAnd + ";", ";" + filterOr + ";"}
+
+type filterTokenKind int
+
+const (
+	tokenCondition filterTokenKind = iota
+	tokenAnd
+	tokenOr
+	tokenOpenGroup
+	tokenCloseGroup
+)
+
+type filterToken struct {
+	kind  filterTokenKind
+	value string
+	// position of the token in filter
+	offset int
+}
+
+// filterNode is a node of the parsed filter expression.
+// a node with empty op is a single condition (field:clause:value),
+// otherwise it joins its children with op (AND / OR)
+type filterNode struct {
+	op       string
+	children []*filterNode
+
+	field  string
+	clause string
+	value  string
+	offset int
+}
+
+// tokenizeFilter split filter into conditions, boolean operators and groups
+// ex: (jenis:eq:POLDA;OR;jenis:eq:POLRES);AND;nama:like:x
+func tokenizeFilter(filter string) (tokens []filterToken) {
+	offset := 0
+	rest := filter
+
+	for {
+		idx, sep := nextFilterSeparator(rest)
+
+		segment := rest
+		if idx >= 0 {
+			segment = rest[:idx]
+		}
+
+		start := offset
+		for strings.HasPrefix(segment, "(") {
+			tokens = append(tokens, filterToken{kind: tokenOpenGroup, value: "(", offset: start})
+			segment = segment[1:]
+			start++
+		}
+
+		// trailing closing bracket that matches an open bracket of the value is part of the value,
+		// ex: nama:eq:POLDA METRO (PMJ). the others close a group, the parser
+		// reject the one without open group as unbalanced bracket
+		closing := 0
+		for strings.HasSuffix(segment, ")") {
+			segment = segment[:len(segment)-1]
+			closing++
+		}
+		for open := strings.Count(segment, "(") - strings.Count(segment, ")"); open > 0 && closing > 0; open-- {
+			segment += ")"
+			closing--
+		}
+
+		tokens = append(tokens, filterToken{kind: tokenCondition, value: segment, offset: start})
+		for i := 0; i < closing; i++ {
+			tokens = append(tokens, filterToken{kind: tokenCloseGroup, value: ")", offset: start + len(segment) + i})
+		}
+
+		if idx < 0 {
+			return
+		}
+
+		offset += idx
+		if strings.Contains(sep, filterAnd) {
+			tokens = append(tokens, filterToken{kind: tokenAnd, value: sep, offset: offset})
+		} else {
+			tokens = append(tokens, filterToken{kind: tokenOr, value: sep, offset: offset})
+		}
+
+		offset += len(sep)
+		rest = rest[idx+len(sep):]
+	}
+}
+
+func nextFilterSeparator(s string) (idx int, sep string) {
+	idx = -1
+	for _, v := range filterSeparators {
+		i := strings.Index(s, v)
+		if i >= 0 && (idx < 0 || i < idx) {
+			idx = i
+			sep = v
+		}
+	}
+
+	return
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// parseFilter parse filter into expression tree
+// AND has higher precedence than OR, use bracket to group the conditions
+func parseFilter(filter string) (node *filterNode, err error) {
+	p := filterParser{tokens: tokenizeFilter(filter)}
+
+	node, err = p.parseOr()
+	if err != nil {
+		return
+	}
+
+	if t, ok := p.peek(); ok {
+		err = newFilterError(t.value, t.offset, errUnbalancedBracket)
+		node = nil
+	}
+
+	return
+}
+
+// end return position after the last token
+func (p *filterParser) end() int {
+	if len(p.tokens) == 0 {
+		return 0
+	}
+
+	last := p.tokens[len(p.tokens)-1]
+	return last.offset + len(last.value)
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, false
+	}
+
+	return p.tokens[p.pos], true
+}
+
+func (p *filterParser) parseOr() (*filterNode, error) {
+	return p.parseBinary(filterOr, tokenOr, p.parseAnd)
+}
+
+func (p *filterParser) parseAnd() (*filterNode, error) {
+	return p.parseBinary(filterAnd, tokenAnd, p.parseFactor)
+}
+
+func (p *filterParser) parseBinary(op string, kind filterTokenKind, next func() (*filterNode, error)) (*filterNode, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	node := left
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != kind {
+			return node, nil
+		}
+		p.pos++
+
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+
+		if node == left {
+			node = &filterNode{op: op, children: []*filterNode{left}}
+		}
+		node.children = append(node.children, right)
+	}
+}
+
+func (p *filterParser) parseFactor() (*filterNode, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, newFilterError("", p.end(), errInvalidFilter)
+	}
+
+	switch t.kind {
+	case tokenOpenGroup:
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if closing, ok := p.peek(); !ok || closing.kind != tokenCloseGroup {
+			return nil, newFilterError(t.value, t.offset, errUnbalancedBracket)
+		}
+		p.pos++
+
+		return node, nil
+	case tokenCondition:
+		p.pos++
+		qf := strings.Split(t.value, ":")
+		if len(qf) != 3 {
+			return nil, newFilterError(t.value, t.offset, errInvalidFilter)
+		}
+
+		return &filterNode{field: qf[0], clause: qf[1], value: qf[2], offset: t.offset}, nil
+	default:
+		return nil, newFilterError(t.value, t.offset, errInvalidFilter)
+	}
+}
+
+func (n *filterNode) fragment() string {
+	return n.field + ":" + n.clause + ":" + n.value
+}
+
+// conditions return all conditions in the tree from left to right
+func (n *filterNode) conditions() (nodes []*filterNode) {
+	if n.op == "" {
+		return []*filterNode{n}
+	}
+
+	for _, c := range n.children {
+		nodes = append(nodes, c.conditions()...)
+	}
+
+	return
+}
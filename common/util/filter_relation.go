@@ -0,0 +1,129 @@
+package util
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// filterTarget is the column that will be filtered
+// when relations is not empty, the column is on the last related model
+// and the condition is wrapped with EXISTS subquery
+type filterTarget struct {
+	name      string
+	typ       reflect.Type
+	relations []*schema.Relationship
+	aliases   []string
+}
+
+// resolveFilterTarget resolve filter name into column of the model,
+// dotted name (ex: parent.nama, wilayahs.jenis) is resolved through gorm relationship
+func resolveFilterTarget(s *schema.Schema, name string, f reflect.StructField) (t filterTarget, err error) {
+	segments := strings.Split(name, ".")
+	if len(segments) == 1 {
+		return filterTarget{name: name, typ: f.Type}, nil
+	}
+
+	current := s
+	for i, segment := range segments[:len(segments)-1] {
+		rel := lookUpRelation(current, segment)
+		if rel == nil || rel.Polymorphic != nil {
+			err = fmt.Errorf("invalid query filter for '%s'", name)
+			return
+		}
+
+		t.relations = append(t.relations, rel)
+		t.aliases = append(t.aliases, strings.Join(segments[:i+1], "_"))
+		current = rel.FieldSchema
+	}
+
+	field := current.LookUpField(segments[len(segments)-1])
+	if field == nil || field.DBName == "" {
+		err = fmt.Errorf("invalid query filter for '%s'", name)
+		return
+	}
+
+	t.name = field.DBName
+	t.typ = field.FieldType
+
+	return
+}
+
+func lookUpRelation(s *schema.Schema, name string) *schema.Relationship {
+	namer := schema.NamingStrategy{}
+	for _, rel := range s.Relationships.Relations {
+		if rel.Name == name || namer.ColumnName("", rel.Name) == name {
+			return rel
+		}
+	}
+
+	return nil
+}
+
+func (t filterTarget) column(tableName string) string {
+	if len(t.aliases) > 0 {
+		tableName = t.aliases[len(t.aliases)-1]
+	}
+
+	return tableName + "." + t.name
+}
+
+// wrap the condition with EXISTS subquery for each relation
+// ex: EXISTS (SELECT 1 FROM kepolisians parent WHERE parent.id = kepolisians.parent_id AND parent.nama ILIKE ?)
+func (t filterTarget) wrap(tableName, cond string) string {
+	for i := len(t.relations) - 1; i >= 0; i-- {
+		outer := tableName
+		if i > 0 {
+			outer = t.aliases[i-1]
+		}
+
+		cond = existsRelation(t.relations[i], outer, t.aliases[i], cond)
+	}
+
+	return cond
+}
+
+func existsRelation(rel *schema.Relationship, outer, alias, cond string) string {
+	var from string
+	var where []string
+
+	if rel.JoinTable != nil {
+		join := alias + "_join"
+		var on []string
+		for _, ref := range rel.References {
+			if ref.OwnPrimaryKey {
+				where = append(where, fmt.Sprintf("%s.%s = %s.%s", join, ref.ForeignKey.DBName, outer, ref.PrimaryKey.DBName))
+			} else {
+				on = append(on, fmt.Sprintf("%s.%s = %s.%s", alias, ref.PrimaryKey.DBName, join, ref.ForeignKey.DBName))
+			}
+		}
+
+		from = fmt.Sprintf("%s %s JOIN %s %s ON %s", rel.JoinTable.Table, join, rel.FieldSchema.Table, alias, strings.Join(on, " AND "))
+	} else {
+		for _, ref := range rel.References {
+			if ref.OwnPrimaryKey {
+				where = append(where, fmt.Sprintf("%s.%s = %s.%s", alias, ref.ForeignKey.DBName, outer, ref.PrimaryKey.DBName))
+			} else {
+				where = append(where, fmt.Sprintf("%s.%s = %s.%s", alias, ref.PrimaryKey.DBName, outer, ref.ForeignKey.DBName))
+			}
+		}
+
+		from = rel.FieldSchema.Table + " " + alias
+	}
+
+	// skip soft deleted row of related model
+	for _, f := range rel.FieldSchema.Fields {
+		if f.FieldType == deletedAtType && f.DBName != "" {
+			where = append(where, fmt.Sprintf("%s.%s IS NULL", alias, f.DBName))
+		}
+	}
+
+	where = append(where, cond)
+
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s)", from, strings.Join(where, " AND "))
+}
@@ -0,0 +1,131 @@
+package util
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Enum is implemented by enum type (ex: models.JenisWilayah)
+// so filter value can be validated before it's sent to database
+type Enum interface {
+	IsValid() bool
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	enumType            = reflect.TypeOf((*Enum)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func invalidFilterValue(name, value string) error {
+	return fmt.Errorf("%w: invalid value '%s' for '%s'", ErrValidation, value, name)
+}
+
+// coerceFilterValue convert value from client to the type of the struct field
+// time.Time is accepted as epoch millisecond or date (2006-01-02)
+func coerceFilterValue(name string, typ reflect.Type, value string) (any, error) {
+	v, err := coerceFilterReflectValue(name, typ, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.Interface(), nil
+}
+
+// coerceFilterValues is coerceFilterValue for list of values,
+// the result is slice of the struct field type (ex: []string, []int)
+func coerceFilterValues(name string, typ reflect.Type, values []string) (any, error) {
+	typ = indirectType(typ)
+
+	s := reflect.MakeSlice(reflect.SliceOf(typ), 0, len(values))
+	for _, value := range values {
+		v, err := coerceFilterReflectValue(name, typ, value)
+		if err != nil {
+			return nil, err
+		}
+
+		s = reflect.Append(s, v)
+	}
+
+	return s.Interface(), nil
+}
+
+func coerceFilterReflectValue(name string, typ reflect.Type, value string) (v reflect.Value, err error) {
+	typ = indirectType(typ)
+	v = reflect.New(typ).Elem()
+
+	switch {
+	case typ == timeType:
+		var t time.Time
+		t, err = parseFilterTime(value)
+		if err != nil {
+			return v, invalidFilterValue(name, value)
+		}
+		v.Set(reflect.ValueOf(t))
+
+		return
+	case reflect.PtrTo(typ).Implements(textUnmarshalerType):
+		// ex: uuid.UUID
+		if err = v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value)); err != nil {
+			return v, invalidFilterValue(name, value)
+		}
+
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(value); err != nil {
+			return v, invalidFilterValue(name, value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = strconv.ParseInt(value, 10, typ.Bits()); err != nil {
+			return v, invalidFilterValue(name, value)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var i uint64
+		if i, err = strconv.ParseUint(value, 10, typ.Bits()); err != nil {
+			return v, invalidFilterValue(name, value)
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(value, typ.Bits()); err != nil {
+			return v, invalidFilterValue(name, value)
+		}
+		v.SetFloat(f)
+	default:
+		return v, fmt.Errorf("%w: filter is not supported for '%s'", ErrValidation, name)
+	}
+
+	if typ.Implements(enumType) && !v.Interface().(Enum).IsValid() {
+		return v, invalidFilterValue(name, value)
+	}
+
+	return
+}
+
+func parseFilterTime(value string) (time.Time, error) {
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(i), nil
+	}
+
+	return time.Parse("2006-01-02", value)
+}
+
+func indirectType(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	return typ
+}
@@ -5,4 +5,8 @@ type ContextKey int
 const (
 	ContextClaims ContextKey = iota
 	ContextClaimsBytes
+	// changed client field of the session, see sessions.ClientChanged
+	ContextSessionChanged
+	// session id of the request, see sessions.CurrentID
+	ContextSessionID
 )
@@ -8,202 +8,282 @@ import (
 	"sync"
 	"time"
 
-	"github.com/tigapilarmandiri/perkakas"
 	"gorm.io/gorm/schema"
 )
 
-var allowedClause = map[string]string{
-	"eq":        " = ?",
-	"neq":       " != ?",
-	"like":      " ILIKE ?",
-	"startWith": " ILIKE ?",
-	"endWith":   " ILIKE ?",
-	"in":        " IN ?",
-	"gt":        " > ? ",
-	"gte":       " >= ? ",
-	"lt":        " < ? ",
-	"lte":       " <= ? ",
+// allowedClause is list of operators that can be used on query filter
+// ex: tanggal:between:1672531200000,1675209600000
+var allowedClause = map[string]clauseOperator{
+	"eq":        {query: " = ?", values: valueOne, accept: kindScalar},
+	"neq":       {query: " != ?", values: valueOne, accept: kindScalar},
+	"like":      {query: " ILIKE ?", values: valueOne, accept: kindString},
+	"nlike":     {query: " NOT ILIKE ?", values: valueOne, accept: kindString},
+	"startWith": {query: " ILIKE ?", values: valueOne, accept: kindString},
+	"endWith":   {query: " ILIKE ?", values: valueOne, accept: kindString},
+	"in":        {query: " IN ?", values: valueMany, accept: kindScalar},
+	"nin":       {query: " NOT IN ?", values: valueMany, accept: kindScalar},
+	"gt":        {query: " > ? ", values: valueOne, accept: kindOrdered},
+	"gte":       {query: " >= ? ", values: valueOne, accept: kindOrdered},
+	"lt":        {query: " < ? ", values: valueOne, accept: kindOrdered},
+	"lte":       {query: " <= ? ", values: valueOne, accept: kindOrdered},
+	"between":   {query: " BETWEEN ? AND ?", values: valueTwo, accept: kindOrdered},
+	"isnull":    {query: " is null ", values: valueNone, accept: kindAny},
+	"notnull":   {query: " is not null ", values: valueNone, accept: kindAny},
+	// array column contains all of the values
+	"contains": {query: " @> ?", values: valueMany, accept: kindArray},
+	// array column contains any of the values
+	"overlap": {query: " && ?", values: valueMany, accept: kindArray},
+	// jsonb column contains the key=value pairs, ex: meta:jcontains:role=admin,active=true
+	"jcontains": {query: " @> ?::jsonb", values: valueMany, accept: kindJSON},
 }
 
 var listDatetime = []string{"tanggal", "dari_tanggal", "sampai_tanggal"}
 
-func validateField(m any, fileds ...string) error {
-	var tags []string
-	val := reflect.ValueOf(m)
-	for i := 0; i < val.Type().NumField(); i++ {
-		t := val.Type().Field(i)
-		field := t.Tag.Get("filter")
+// filterFields return fields that have filter tag, keyed by the tag
+// fields of embedded struct are included
+// a tag can contain multiple names separated by comma, it is used on relation field
+// to allow filter on the related model, ex: `filter:"parent.nama,parent.jenis"`
+func filterFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
 
-		tags = append(tags, field)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fields
 	}
 
-	for _, f := range fileds {
-		match := false
-
-		// avoid if filter is empty or field equal "-"
-		if len(f) > 0 && f != "-" {
-			for _, t := range tags {
-				if f == t {
-					match = true
-					break
-				}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			for k, v := range filterFields(f.Type) {
+				fields[k] = v
 			}
+			continue
 		}
 
-		if !match {
-			return fmt.Errorf("invalid query filter for '%s'", f)
+		for _, tag := range strings.Split(f.Tag.Get("filter"), ",") {
+			// avoid if filter is empty or field equal "-"
+			if len(tag) > 0 && tag != "-" {
+				fields[tag] = f
+			}
 		}
+	}
+
+	return fields
+}
 
+func validateField(m any, field string) (reflect.StructField, error) {
+	f, ok := filterFields(reflect.TypeOf(m))[field]
+	if !ok {
+		return f, fmt.Errorf("invalid query filter for '%s'", field)
+	}
+
+	return f, nil
+}
+
+// isDatetimeField is used for string field that contain datetime,
+// the value from client is in epoch millisecond
+func isDatetimeField(field string) bool {
+	for _, v := range listDatetime {
+		// field is table_name.field
+		if strings.HasSuffix(field, v) {
+			return true
+		}
 	}
 
-	return nil
+	return false
 }
 
-func buildClause(field, clause, value string) (query string, arg any, err error) {
+// @field is column name, table_name.field
+// @name is the filter tag, used on the error message
+// @typ is type of struct field that contain filter tag
+func buildClause(field, name string, typ reflect.Type, clause, value string) (query string, args []any, err error) {
 	c, ok := allowedClause[clause]
 	if !ok {
-		err = fmt.Errorf("invalid clause")
+		err = errInvalidClause
 		return
 	}
 
-	query = field + c
-	arg = value
+	if value == "null" && (clause == "eq" || clause == "neq") {
+		c = allowedClause["isnull"]
+		if clause == "neq" {
+			c = allowedClause["notnull"]
+		}
+		value = ""
+	}
+
+	if classifyField(typ)&c.accept == 0 {
+		err = fmt.Errorf("%w: clause '%s' is not supported for '%s'", ErrValidation, clause, name)
+		return
+	}
+
+	var values []string
+	values, err = c.splitValues(clause, name, value)
+	if err != nil {
+		return
+	}
+
+	query = field + c.query
 
-	// var i int
 	switch clause {
-	case "like":
-		arg = "%" + value + "%"
+	case "like", "nlike":
+		args = []any{"%" + value + "%"}
 	case "startWith":
-		arg = value + "%"
+		args = []any{value + "%"}
 	case "endWith":
-		arg = "%" + value
-	case "eq":
-		if value == "null" {
-			query = field + " is null "
-			arg = nil
+		args = []any{"%" + value}
+	case "in", "nin":
+		var arg any
+		if indirectType(typ).Kind() == reflect.String && isDatetimeField(field) {
+			arg, err = epochsToRFC3339(name, values)
+		} else {
+			arg, err = coerceFilterValues(name, typ, values)
 		}
-		// i, err = strconv.Atoi(value)
-		// if err == nil {
-		// 	arg = i
-		// }
-		// err = nil
-		for _, v := range listDatetime {
-			if len(field) < len(v) {
-				continue
+		args = []any{arg}
+	case "contains", "overlap":
+		var arg string
+		arg, err = arrayFilterValue(name, typ, values)
+		args = []any{arg}
+	case "jcontains":
+		var arg string
+		arg, err = jsonFilterValue(name, values)
+		args = []any{arg}
+	default:
+		for _, v := range values {
+			var arg any
+			arg, err = coerceFilterValue(name, typ, v)
+			if err != nil {
+				return
 			}
-			if v == field[len(field)-len(v):] {
-				// field is table_name.field
-				i, err := strconv.Atoi(value)
-				if err != nil {
-					return "", nil, err
-				}
-				t := time.UnixMilli(int64(i))
-				arg = t.Format(time.RFC3339)
-			}
-		}
-	case "in":
-		s := strings.Split(value, ",")
-		arg = s
-		// _, err = strconv.Atoi(s[0])
-		// if err == nil {
-		// 	arrInt := make([]int, 0, len(s))
-		// 	for _, v := range s {
-		// 		i, err = strconv.Atoi(v)
-		// 		if err != nil {
-		// 			err = fmt.Errorf("invalid values")
-		// 			return
-		// 		}
-		//
-		// 		arrInt = append(arrInt, i)
-		// 	}
-		// 	arg = arrInt
-		// } else {
-		// 	err = nil
-		// }
-	case "gt", "gte", "lt", "lte":
-		for _, v := range listDatetime {
-			// field is table_name.field
-			if v == field[len(field)-len(v):] {
-				i, err := strconv.Atoi(value)
+
+			if indirectType(typ).Kind() == reflect.String && isDatetimeField(field) {
+				arg, err = epochToRFC3339(name, v)
 				if err != nil {
-					return "", nil, err
+					return
 				}
-				t := time.UnixMilli(int64(i))
-				arg = t.Format(time.RFC3339)
 			}
+
+			args = append(args, arg)
 		}
+	}
 
+	if err != nil {
+		args = nil
 	}
 
 	return
 }
 
-func getFilter(filter string) (filters []string, cond string) {
-	// default
-	filters = append(filters, filter)
+func epochToRFC3339(name, value string) (string, error) {
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return "", invalidFilterValue(name, value)
+	}
+
+	return time.UnixMilli(i).Format(time.RFC3339), nil
+}
+
+// epochsToRFC3339 is epochToRFC3339 for every value of in and nin clause
+func epochsToRFC3339(name string, values []string) ([]string, error) {
+	s := make([]string, 0, len(values))
+	for _, v := range values {
+		t, err := epochToRFC3339(name, v)
+		if err != nil {
+			return nil, err
+		}
 
-	if strings.Contains(filter, ";AND;") {
-		filters = strings.Split(filter, ";AND;")
-		cond = "AND"
-	} else if strings.Contains(filter, ";OR;") {
-		filters = strings.Split(filter, ";OR;")
-		cond = "OR"
+		s = append(s, t)
 	}
 
-	return
+	return s, nil
 }
 
 // @m is a struct that contain filter tag
 // @filter is query filter from client
 // ex: name:eq:omama
+// conditions can be joined with ;AND; / ;OR; and grouped with bracket
+// ex: (jenis:eq:POLDA;OR;jenis:eq:POLRES);AND;nama:like:jakarta
+// field of related model is filtered with dotted path, ex: parent.nama:like:jakarta
+// error from invalid filter is *FilterError
 func BuildFilterQuery(m any, filter string) (query string, args []any, err error) {
-	filters, cond := getFilter(filter)
+	var node *filterNode
+	node, err = parseFilter(filter)
+	if err != nil {
+		return
+	}
+
 	var s *schema.Schema
 	s, err = schema.Parse(m, &sync.Map{}, schema.NamingStrategy{})
 	if err != nil {
 		return
 	}
-	tableName := s.Table
 
-	for _, f := range filters {
-		qf := strings.Split(f, ":")
-		if len(qf) != 3 {
-			err = fmt.Errorf("invalid query filter")
+	targets := make(map[string]filterTarget)
+	for _, c := range node.conditions() {
+		var f reflect.StructField
+		if f, err = validateField(m, c.field); err != nil {
+			err = newConditionError(c, err)
 			return
 		}
 
-		field, clause, value := qf[0], qf[1], qf[2]
-		if err = validateField(m, field); err != nil {
+		var t filterTarget
+		if t, err = resolveFilterTarget(s, c.field, f); err != nil {
+			err = newConditionError(c, err)
 			return
 		}
+		targets[c.field] = t
+	}
+
+	query, args, err = buildNodeQuery(node, s.Table, targets)
 
+	return
+}
+
+func buildNodeQuery(node *filterNode, tableName string, targets map[string]filterTarget) (query string, args []any, err error) {
+	if node.op == "" {
+		t := targets[node.field]
+		query, args, err = buildClause(t.column(tableName), node.field, t.typ, node.clause, node.value)
+		if err != nil {
+			err = newConditionError(node, err)
+			return
+		}
+
+		query = t.wrap(tableName, strings.Trim(query, " "))
+
+		return
+	}
+
+	queries := make([]string, 0, len(node.children))
+	for _, c := range node.children {
 		var q string
-		var a any
-		q, a, err = buildClause(tableName+"."+field, clause, value)
+		var a []any
+		q, a, err = buildNodeQuery(c, tableName, targets)
 		if err != nil {
 			return
 		}
 
-		query = fmt.Sprintf("%s %s %s", query, q, cond)
-		if a != nil {
-			args = append(args, a)
+		// nested expression is wrapped to keep the precedence explicit
+		if c.op != "" {
+			q = "(" + q + ")"
 		}
-	}
 
-	// Cleanup condition at end of query
-	if !perkakas.IsEmpty(cond) {
-		query = strings.TrimSuffix(query, cond)
+		queries = append(queries, q)
+		args = append(args, a...)
 	}
 
-	query = strings.Trim(query, " ")
+	query = strings.Join(queries, " "+node.op+" ")
 
 	return
 }
 
 func GetQueryFilter(queryUrl, find string) (field string, operator string, value string) {
-	filters, _ := getFilter(queryUrl)
-	for _, v := range filters {
-		qf := strings.Split(v, ":")
+	for _, t := range tokenizeFilter(queryUrl) {
+		if t.kind != tokenCondition {
+			continue
+		}
+
+		qf := strings.Split(t.value, ":")
 		if len(qf) != 3 {
 			continue
 		}
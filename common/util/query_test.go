@@ -1,9 +1,13 @@
 package util
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 func TestQuery(t *testing.T) {
@@ -107,3 +111,380 @@ func TestQuery(t *testing.T) {
 	_, _, e = BuildFilterQuery(omama{}, "test:omama:value;;name:eq:myName")
 	require.EqualError(t, e, "invalid query filter")
 }
+
+func TestQueryGroup(t *testing.T) {
+	type omama struct {
+		Jenis string `filter:"jenis"`
+		Nama  string `filter:"nama"`
+		Kode  string `filter:"kode"`
+	}
+
+	var q string
+	var a []interface{}
+	var e error
+
+	q, a, e = BuildFilterQuery(omama{}, "(jenis:eq:POLDA;OR;jenis:eq:POLRES);AND;nama:like:x")
+	require.NoError(t, e)
+	require.Equal(t, "(omamas.jenis = ? OR omamas.jenis = ?) AND omamas.nama ILIKE ?", q)
+	require.Equal(t, []any{"POLDA", "POLRES", "%x%"}, a)
+
+	// AND has higher precedence than OR
+	q, a, e = BuildFilterQuery(omama{}, "jenis:eq:POLDA;OR;jenis:eq:POLRES;AND;nama:like:x")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.jenis = ? OR (omamas.jenis = ? AND omamas.nama ILIKE ?)", q)
+	require.Equal(t, []any{"POLDA", "POLRES", "%x%"}, a)
+
+	q, a, e = BuildFilterQuery(omama{}, "nama:like:x;AND;(jenis:eq:POLDA;OR;(jenis:eq:POLRES;AND;kode:startWith:31))")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.nama ILIKE ? AND (omamas.jenis = ? OR (omamas.jenis = ? AND omamas.kode ILIKE ?))", q)
+	require.Equal(t, []any{"%x%", "POLDA", "POLRES", "31%"}, a)
+
+	q, a, e = BuildFilterQuery(omama{}, "(jenis:eq:POLDA)")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.jenis = ?", q)
+	require.Equal(t, []any{"POLDA"}, a)
+
+	// bracket of the value
+	q, a, e = BuildFilterQuery(omama{}, "nama:eq:POLDA METRO (PMJ)")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.nama = ?", q)
+	require.Equal(t, []any{"POLDA METRO (PMJ)"}, a)
+
+	q, a, e = BuildFilterQuery(omama{}, "(nama:eq:POLDA METRO (PMJ);OR;nama:like:(x));AND;jenis:eq:POLDA")
+	require.NoError(t, e)
+	require.Equal(t, "(omamas.nama = ? OR omamas.nama ILIKE ?) AND omamas.jenis = ?", q)
+	require.Equal(t, []any{"POLDA METRO (PMJ)", "%(x)%", "POLDA"}, a)
+
+	// closing bracket without open group
+	_, _, e = BuildFilterQuery(omama{}, "nama:eq:abc)")
+	require.EqualError(t, e, "unbalanced bracket in query filter")
+
+	_, _, e = BuildFilterQuery(omama{}, "(jenis:eq:POLDA;OR;jenis:eq:POLRES)));AND;nama:eq:c")
+	require.EqualError(t, e, "unbalanced bracket in query filter")
+
+	_, _, e = BuildFilterQuery(omama{}, "(jenis:eq:POLDA;OR;jenis:eq:POLRES")
+	require.EqualError(t, e, "unbalanced bracket in query filter")
+
+	_, _, e = BuildFilterQuery(omama{}, "(jenis:eq:POLDA;OR;xxx:eq:POLRES);AND;nama:like:x")
+	require.EqualError(t, e, "invalid query filter for 'xxx'")
+
+	_, _, e = BuildFilterQuery(omama{}, "jenis:eq:POLDA;OR;")
+	require.EqualError(t, e, "invalid query filter")
+}
+
+func TestGetQueryFilter(t *testing.T) {
+	f, o, v := GetQueryFilter("(jenis:eq:POLDA;OR;jenis:eq:POLRES);AND;nama:like:x", "nama")
+	require.Equal(t, "nama", f)
+	require.Equal(t, "like", o)
+	require.Equal(t, "x", v)
+
+	f, _, _ = GetQueryFilter("jenis:eq:POLDA", "nama")
+	require.Equal(t, "", f)
+}
+
+type testJenis string
+
+func (j testJenis) IsValid() bool {
+	return j == "POLDA" || j == "POLRES"
+}
+
+func TestQueryValueType(t *testing.T) {
+	type omama struct {
+		Umur    int        `filter:"umur"`
+		Nilai   float64    `filter:"nilai"`
+		Active  *bool      `filter:"active"`
+		Created time.Time  `filter:"created_at"`
+		Uuid    uuid.UUID  `filter:"uuid"`
+		Jenis   testJenis  `filter:"jenis"`
+		Tanggal string     `filter:"tanggal"`
+		Parent  *time.Time `filter:"parent_at"`
+	}
+
+	var q string
+	var a []interface{}
+	var e error
+
+	q, a, e = BuildFilterQuery(omama{}, "umur:gte:17")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.umur >= ?", q)
+	require.Equal(t, []any{17}, a)
+
+	_, a, e = BuildFilterQuery(omama{}, "umur:in:1,2,3")
+	require.NoError(t, e)
+	require.Equal(t, []any{[]int{1, 2, 3}}, a)
+
+	_, a, e = BuildFilterQuery(omama{}, "nilai:lt:2.5")
+	require.NoError(t, e)
+	require.Equal(t, []any{2.5}, a)
+
+	_, a, e = BuildFilterQuery(omama{}, "active:eq:true")
+	require.NoError(t, e)
+	require.Equal(t, []any{true}, a)
+
+	q, a, e = BuildFilterQuery(omama{}, "active:eq:null")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.active is null", q)
+	require.Equal(t, 0, len(a))
+
+	_, a, e = BuildFilterQuery(omama{}, "created_at:gte:1672531200000")
+	require.NoError(t, e)
+	require.True(t, time.UnixMilli(1672531200000).Equal(a[0].(time.Time)))
+
+	_, a, e = BuildFilterQuery(omama{}, "parent_at:lt:2023-01-01")
+	require.NoError(t, e)
+	require.True(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).Equal(a[0].(time.Time)))
+
+	id := uuid.New()
+	_, a, e = BuildFilterQuery(omama{}, "uuid:eq:"+id.String())
+	require.NoError(t, e)
+	require.Equal(t, []any{id}, a)
+
+	_, a, e = BuildFilterQuery(omama{}, "jenis:in:POLDA,POLRES")
+	require.NoError(t, e)
+	require.Equal(t, []any{[]testJenis{"POLDA", "POLRES"}}, a)
+
+	_, a, e = BuildFilterQuery(omama{}, "tanggal:eq:1672531200000")
+	require.NoError(t, e)
+	require.Equal(t, []any{time.UnixMilli(1672531200000).Format(time.RFC3339)}, a)
+
+	_, a, e = BuildFilterQuery(omama{}, "tanggal:in:1672531200000,1672617600000")
+	require.NoError(t, e)
+	require.Equal(t, []any{[]string{time.UnixMilli(1672531200000).Format(time.RFC3339), time.UnixMilli(1672617600000).Format(time.RFC3339)}}, a)
+
+	_, _, e = BuildFilterQuery(omama{}, "tanggal:nin:1672531200000,2023-01-02")
+	require.EqualError(t, e, "error validation: invalid value '2023-01-02' for 'tanggal'")
+
+	_, _, e = BuildFilterQuery(omama{}, "umur:eq:abc")
+	require.EqualError(t, e, "error validation: invalid value 'abc' for 'umur'")
+	require.ErrorIs(t, e, ErrValidation)
+
+	_, _, e = BuildFilterQuery(omama{}, "umur:in:1,b")
+	require.EqualError(t, e, "error validation: invalid value 'b' for 'umur'")
+
+	_, _, e = BuildFilterQuery(omama{}, "active:eq:yes")
+	require.EqualError(t, e, "error validation: invalid value 'yes' for 'active'")
+
+	_, _, e = BuildFilterQuery(omama{}, "created_at:gt:kemarin")
+	require.EqualError(t, e, "error validation: invalid value 'kemarin' for 'created_at'")
+
+	_, _, e = BuildFilterQuery(omama{}, "uuid:eq:123")
+	require.EqualError(t, e, "error validation: invalid value '123' for 'uuid'")
+
+	_, _, e = BuildFilterQuery(omama{}, "jenis:eq:POLSEK")
+	require.EqualError(t, e, "error validation: invalid value 'POLSEK' for 'jenis'")
+
+	_, _, e = BuildFilterQuery(omama{}, "tanggal:gt:kemarin")
+	require.EqualError(t, e, "error validation: invalid value 'kemarin' for 'tanggal'")
+
+	// embedded struct and pointer to struct
+	type embedded struct {
+		omama
+		Nama string `filter:"nama"`
+	}
+
+	q, a, e = BuildFilterQuery(&embedded{}, "umur:eq:1;AND;nama:eq:x")
+	require.NoError(t, e)
+	require.Equal(t, "embeddeds.umur = ? AND embeddeds.nama = ?", q)
+	require.Equal(t, []any{1, "x"}, a)
+}
+
+func TestQueryOperator(t *testing.T) {
+	type omama struct {
+		Nama    string            `filter:"nama"`
+		Umur    int               `filter:"umur"`
+		Active  bool              `filter:"active"`
+		Created time.Time         `filter:"created_at"`
+		Tags    []string          `filter:"tags" gorm:"type:text[]"`
+		Kodes   []int             `filter:"kodes" gorm:"type:int[]"`
+		Meta    json.RawMessage   `filter:"meta" gorm:"type:jsonb"`
+		Extra   map[string]string `filter:"extra" gorm:"type:jsonb"`
+	}
+
+	var q string
+	var a []interface{}
+	var e error
+
+	q, a, e = BuildFilterQuery(omama{}, "umur:between:17,30")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.umur BETWEEN ? AND ?", q)
+	require.Equal(t, []any{17, 30}, a)
+
+	q, a, e = BuildFilterQuery(omama{}, "created_at:between:1672531200000,1675209600000")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.created_at BETWEEN ? AND ?", q)
+	require.Equal(t, 2, len(a))
+
+	q, a, e = BuildFilterQuery(omama{}, "nama:nin:a,b")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.nama NOT IN ?", q)
+	require.Equal(t, []any{[]string{"a", "b"}}, a)
+
+	q, a, e = BuildFilterQuery(omama{}, "nama:nlike:abc")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.nama NOT ILIKE ?", q)
+	require.Equal(t, []any{"%abc%"}, a)
+
+	q, a, e = BuildFilterQuery(omama{}, "nama:isnull:;OR;umur:notnull:")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.nama is null OR omamas.umur is not null", q)
+	require.Equal(t, 0, len(a))
+
+	q, a, e = BuildFilterQuery(omama{}, "nama:neq:null")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.nama is not null", q)
+	require.Equal(t, 0, len(a))
+
+	q, a, e = BuildFilterQuery(omama{}, `tags:contains:a,b"c`)
+	require.NoError(t, e)
+	require.Equal(t, "omamas.tags @> ?", q)
+	require.Equal(t, []any{`{"a","b\"c"}`}, a)
+
+	q, a, e = BuildFilterQuery(omama{}, "kodes:overlap:1,2")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.kodes && ?", q)
+	require.Equal(t, []any{`{"1","2"}`}, a)
+
+	q, a, e = BuildFilterQuery(omama{}, "meta:jcontains:role=admin")
+	require.NoError(t, e)
+	require.Equal(t, "omamas.meta @> ?::jsonb", q)
+	require.Equal(t, []any{`{"role":"admin"}`}, a)
+
+	_, a, e = BuildFilterQuery(omama{}, "extra:jcontains:a=1,b=2")
+	require.NoError(t, e)
+	require.Equal(t, []any{`{"a":"1","b":"2"}`}, a)
+
+	_, _, e = BuildFilterQuery(omama{}, "umur:between:17")
+	require.EqualError(t, e, "error validation: clause 'between' need 2 values for 'umur'")
+
+	_, _, e = BuildFilterQuery(omama{}, "umur:between:17,a")
+	require.EqualError(t, e, "error validation: invalid value 'a' for 'umur'")
+
+	_, _, e = BuildFilterQuery(omama{}, "nama:isnull:true")
+	require.EqualError(t, e, "error validation: clause 'isnull' doesn't need value for 'nama'")
+
+	_, _, e = BuildFilterQuery(omama{}, "umur:like:1")
+	require.EqualError(t, e, "error validation: clause 'like' is not supported for 'umur'")
+
+	_, _, e = BuildFilterQuery(omama{}, "active:gt:true")
+	require.EqualError(t, e, "error validation: clause 'gt' is not supported for 'active'")
+
+	_, _, e = BuildFilterQuery(omama{}, "tags:eq:a")
+	require.EqualError(t, e, "error validation: clause 'eq' is not supported for 'tags'")
+
+	_, _, e = BuildFilterQuery(omama{}, "nama:contains:a")
+	require.EqualError(t, e, "error validation: clause 'contains' is not supported for 'nama'")
+
+	_, _, e = BuildFilterQuery(omama{}, "kodes:contains:1,a")
+	require.EqualError(t, e, "error validation: invalid value 'a' for 'kodes'")
+
+	_, _, e = BuildFilterQuery(omama{}, "meta:jcontains:role")
+	require.EqualError(t, e, "error validation: invalid value 'role' for 'meta'")
+}
+
+type TestModel struct {
+	ID        string `gorm:"type:uuid;primarykey"`
+	DeletedAt gorm.DeletedAt
+}
+
+type testKepolisian struct {
+	TestModel
+
+	Nama  string `filter:"nama"`
+	Jenis string `filter:"jenis"`
+
+	ParentID *string         `gorm:"type:uuid"`
+	Parent   *testKepolisian `gorm:"foreignKey:ParentID" filter:"parent.nama,parent.parent.jenis"`
+
+	Wilayahs []*testWilayah `gorm:"many2many:kepolisian_has_wilayah" filter:"wilayahs.jenis,test_wilayahs.nama"`
+	Anggotas []*testAnggota `gorm:"foreignKey:KepolisianID" filter:"anggotas.umur,anggotas.unknown"`
+}
+
+type testWilayah struct {
+	TestModel
+
+	Nama  string
+	Jenis testJenis
+}
+
+type testAnggota struct {
+	ID           string
+	KepolisianID string
+	Umur         int
+}
+
+func TestQueryRelation(t *testing.T) {
+	var q string
+	var a []interface{}
+	var e error
+
+	q, a, e = BuildFilterQuery(testKepolisian{}, "parent.nama:like:jakarta")
+	require.NoError(t, e)
+	require.Equal(t, "EXISTS (SELECT 1 FROM test_kepolisians parent WHERE parent.id = test_kepolisians.parent_id AND parent.deleted_at IS NULL AND parent.nama ILIKE ?)", q)
+	require.Equal(t, []any{"%jakarta%"}, a)
+
+	q, a, e = BuildFilterQuery(testKepolisian{}, "wilayahs.jenis:eq:POLDA;AND;nama:eq:x")
+	require.NoError(t, e)
+	require.Equal(t, "EXISTS (SELECT 1 FROM kepolisian_has_wilayah wilayahs_join JOIN test_wilayahs wilayahs ON wilayahs.id = wilayahs_join.test_wilayah_id WHERE wilayahs_join.test_kepolisian_id = test_kepolisians.id AND wilayahs.deleted_at IS NULL AND wilayahs.jenis = ?) AND test_kepolisians.nama = ?", q)
+	require.Equal(t, []any{testJenis("POLDA"), "x"}, a)
+
+	q, a, e = BuildFilterQuery(testKepolisian{}, "anggotas.umur:gte:17")
+	require.NoError(t, e)
+	require.Equal(t, "EXISTS (SELECT 1 FROM test_anggota anggotas WHERE anggotas.kepolisian_id = test_kepolisians.id AND anggotas.umur >= ?)", q)
+	require.Equal(t, []any{17}, a)
+
+	q, a, e = BuildFilterQuery(testKepolisian{}, "parent.parent.jenis:eq:MABES")
+	require.NoError(t, e)
+	require.Equal(t, "EXISTS (SELECT 1 FROM test_kepolisians parent WHERE parent.id = test_kepolisians.parent_id AND parent.deleted_at IS NULL AND EXISTS (SELECT 1 FROM test_kepolisians parent_parent WHERE parent_parent.id = parent.parent_id AND parent_parent.deleted_at IS NULL AND parent_parent.jenis = ?))", q)
+	require.Equal(t, []any{"MABES"}, a)
+
+	// type of related field is used
+	_, _, e = BuildFilterQuery(testKepolisian{}, "wilayahs.jenis:eq:POLSEK")
+	require.EqualError(t, e, "error validation: invalid value 'POLSEK' for 'wilayahs.jenis'")
+
+	// not opted in on filter tag
+	_, _, e = BuildFilterQuery(testKepolisian{}, "parent.jenis:eq:POLDA")
+	require.EqualError(t, e, "invalid query filter for 'parent.jenis'")
+
+	// opted in but relation or field doesn't exist
+	_, _, e = BuildFilterQuery(testKepolisian{}, "test_wilayahs.nama:eq:x")
+	require.EqualError(t, e, "invalid query filter for 'test_wilayahs.nama'")
+
+	_, _, e = BuildFilterQuery(testKepolisian{}, "anggotas.unknown:eq:x")
+	require.EqualError(t, e, "invalid query filter for 'anggotas.unknown'")
+}
+
+func TestQueryFilterError(t *testing.T) {
+	type omama struct {
+		Umur int    `filter:"umur"`
+		Nama string `filter:"nama"`
+	}
+
+	tests := []struct {
+		name     string
+		filter   string
+		expected FilterError
+	}{
+		{"invalid value", "nama:eq:x;AND;umur:eq:abc", FilterError{Fragment: "umur:eq:abc", Index: 14, Field: "umur", Operator: "eq", Reason: "error validation: invalid value 'abc' for 'umur'"}},
+		{"invalid field", "(nama:eq:x;OR;xxx:eq:1)", FilterError{Fragment: "xxx:eq:1", Index: 14, Field: "xxx", Operator: "eq", Reason: "invalid query filter for 'xxx'"}},
+		{"invalid clause", "nama:omama:x", FilterError{Fragment: "nama:omama:x", Index: 0, Field: "nama", Operator: "omama", Reason: "invalid clause"}},
+		{"invalid condition", "nama:eq:x;OR;umur", FilterError{Fragment: "umur", Index: 13, Reason: "invalid query filter"}},
+		{"empty condition", "nama:eq:x;OR;", FilterError{Fragment: "", Index: 13, Reason: "invalid query filter"}},
+		{"unclosed bracket", "nama:eq:x;AND;(umur:eq:1;OR;umur:eq:2", FilterError{Fragment: "(", Index: 14, Reason: "unbalanced bracket in query filter"}},
+		{"surplus bracket", "(nama:eq:a;OR;nama:eq:b)));AND;nama:eq:c", FilterError{Fragment: ")", Index: 24, Reason: "unbalanced bracket in query filter"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := BuildFilterQuery(omama{}, tt.filter)
+
+			var fe *FilterError
+			require.ErrorAs(t, err, &fe)
+			fe.Err = nil
+			require.Equal(t, tt.expected, *fe)
+		})
+	}
+
+	_, _, err := BuildFilterQuery(omama{}, "umur:eq:abc")
+	require.ErrorIs(t, err, ErrValidation)
+}
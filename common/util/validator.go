@@ -78,6 +78,18 @@ type ErrorStruct struct {
 	Err     error
 }
 
+func (e *ErrorStruct) Error() string {
+	if e.Err != nil && e.Err.Error() != e.Message {
+		return e.Message + ": " + e.Err.Error()
+	}
+
+	return e.Message
+}
+
+func (e *ErrorStruct) Unwrap() error {
+	return e.Err
+}
+
 func ValidateAndUnmarshal[T any](ctx context.Context, data []byte, model *T) *ErrorStruct {
 	if err := json.Unmarshal(data, model); err != nil {
 		return &ErrorStruct{
@@ -33,6 +33,17 @@ type Configs struct {
 	NatsURL        string `json:"nats_url"`
 	AllowedOrigins string `json:"allowed_origins"`
 
+	// Key to sign pagination cursor
+	CursorKey string `json:"cursor_key"`
+
+	// Register grpc health and reflection server,
+	// reflection should not be enabled on production
+	GRPCHealth     bool `json:"grpc_health"`
+	GRPCReflection bool `json:"grpc_reflection"`
+
+	// Session of the user
+	Session Session `json:"session"`
+
 	// Redpanda
 	Redpanda `json:"redpanda"`
 
@@ -84,6 +95,18 @@ type JWT struct {
 
 	YanmasSecretKey string `json:"yanmas_secret_key"`
 	YanmasDateKey   string `json:"yanmas_date_key"`
+
+	// JWKS is source of the key set to verify asymmetric jwt, SecretKey is used when it's empty.
+	// ex: /etc/jwks.json, https://auth/.well-known/jwks.json or vault://secret/auth#jwks
+	JWKS       string `json:"jwks"`
+	YanmasJWKS string `json:"yanmas_jwks"`
+
+	// SignatureSkew is the max difference in second between the date of request signed with nonce and now.
+	// SignatureRequired reject request that is signed with the legacy signature of the date only.
+	// SignatureMaxBodySize is max body in byte that is read to verify the signature
+	SignatureSkew        int  `json:"signature_skew"`
+	SignatureRequired    bool `json:"signature_required"`
+	SignatureMaxBodySize int  `json:"signature_max_body_size"`
 }
 
 type ConfigOpts struct {
@@ -91,6 +114,23 @@ type ConfigOpts struct {
 	EnvFile string
 }
 
+type Session struct {
+	// ClientCheck compare remote address and user agent of the request with the session,
+	// "flag" log and flag the request, "refuse" refuse the request and empty disable it
+	ClientCheck string `json:"client_check"`
+	// MaxPerUser is max concurrent sessions of a user, the oldest session is evicted on login.
+	// zero or less is unlimited
+	MaxPerUser int `json:"max_per_user"`
+	// AbsoluteTimeout is max lifetime of a session in second since it's created,
+	// zero or less is 24 hours on production and 7 days on others
+	AbsoluteTimeout int `json:"absolute_timeout"`
+	// IdleTimeout expire the session when it's not used in second, zero or less disable it
+	IdleTimeout int `json:"idle_timeout"`
+	// TouchInterval is min interval in second of updating the last seen of the session,
+	// it's at most half of IdleTimeout
+	TouchInterval int `json:"touch_interval"`
+}
+
 type Redpanda struct {
 	Host          string `json:"host"`
 	Port          string `json:"port"`
@@ -183,9 +223,26 @@ func LoadConfigs() (confs Configs) {
 			DateKey:         perkakas.DefaultValueString("secretDateKey", os.Getenv(constant.HMAC_DATE_KEY)),
 			YanmasSecretKey: perkakas.DefaultValueString("secretJwtKey", os.Getenv(constant.YANMAS_JWT_SECRET_KEY)),
 			YanmasDateKey:   perkakas.DefaultValueString("secretDateKey", os.Getenv(constant.YANMAS_HMAC_DATE_KEY)),
+			JWKS:            os.Getenv(constant.JWT_JWKS),
+			YanmasJWKS:      os.Getenv(constant.YANMAS_JWT_JWKS),
+
+			SignatureSkew:        perkakas.DefaultValueIntFromString(300, os.Getenv(constant.JWT_SIGNATURE_SKEW)),
+			SignatureRequired:    perkakas.DefaultValueBoolFromString(false, os.Getenv(constant.JWT_SIGNATURE_REQUIRED)),
+			SignatureMaxBodySize: perkakas.DefaultValueIntFromString(10<<20, os.Getenv(constant.JWT_SIGNATURE_MAX_BODY_SIZE)),
 		},
 		NatsURL:        perkakas.DefaultValueString("localhost:4222", os.Getenv(constant.NATS_URL)),
 		AllowedOrigins: perkakas.DefaultValueString("*", os.Getenv(constant.ALLOWED_ORIGINS)),
+		CursorKey:      perkakas.DefaultValueString("secretCursorKey", os.Getenv(constant.CURSOR_KEY)),
+		GRPCHealth:     perkakas.DefaultValueBoolFromString(true, os.Getenv(constant.GRPC_HEALTH)),
+		GRPCReflection: perkakas.DefaultValueBoolFromString(false, os.Getenv(constant.GRPC_REFLECTION)),
+		Session: Session{
+			ClientCheck: os.Getenv(constant.SESSION_CLIENT_CHECK),
+			MaxPerUser:  perkakas.DefaultValueIntFromString(1, os.Getenv(constant.SESSION_MAX_PER_USER)),
+
+			AbsoluteTimeout: perkakas.DefaultValueIntFromString(0, os.Getenv(constant.SESSION_ABSOLUTE_TIMEOUT)),
+			IdleTimeout:     perkakas.DefaultValueIntFromString(0, os.Getenv(constant.SESSION_IDLE_TIMEOUT)),
+			TouchInterval:   perkakas.DefaultValueIntFromString(60, os.Getenv(constant.SESSION_TOUCH_INTERVAL)),
+		},
 		Redpanda: Redpanda{
 			Host:          perkakas.DefaultValueString("localhost", os.Getenv(constant.RP_HOST)),
 			Port:          perkakas.DefaultValueString("9092", os.Getenv(constant.RP_PORT)),
@@ -5,5 +5,5 @@ import "github.com/tigapilarmandiri/perkakas/common/db"
 type Direktorat struct {
 	db.Model
 
-	Nama string `json:"nama" gorm:"type:varchar;size:200;not null" validate:"required"`
+	Nama string `json:"nama" gorm:"type:varchar;size:200;not null" validate:"required" sort:"nama"`
 }
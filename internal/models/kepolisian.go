@@ -24,13 +24,22 @@ func (ct JenisKepolisian) Value() (driver.Value, error) {
 	return string(ct), nil
 }
 
+func (ct JenisKepolisian) IsValid() bool {
+	switch ct {
+	case MABES, POLDA, POLRES, POLSEK:
+		return true
+	}
+
+	return false
+}
+
 type Kepolisian struct {
 	db.Model
 
-	Kode      string          `json:"kode" gorm:"type:varchar;size:15;not null" validate:"required"`
-	Nama      string          `json:"nama" gorm:"type:varchar;size:255;not null" validate:"required"`
+	Kode      string          `json:"kode" gorm:"type:varchar;size:15;not null" validate:"required" sort:"kode"`
+	Nama      string          `json:"nama" gorm:"type:varchar;size:255;not null" validate:"required" sort:"nama"`
 	Koordinat string          `json:"koordinat" gorm:"type:varchar;size:100;not null" validate:"required"`
-	Jenis     JenisKepolisian `json:"jenis" gorm:"type:jenis_kepolisian;not null;default:POLSEK" validate:"required" filter:"jenis"`
+	Jenis     JenisKepolisian `json:"jenis" gorm:"type:jenis_kepolisian;not null;default:POLSEK" validate:"required" filter:"jenis" sort:"jenis"`
 	Active    *bool           `json:"active" validate:"required"`
 
 	ParentID *string     `json:"parent_id" gorm:"type:uuid"`
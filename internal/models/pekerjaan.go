@@ -5,8 +5,8 @@ import "github.com/tigapilarmandiri/perkakas/common/db"
 type Pekerjaan struct {
 	db.Model
 
-	Kode   string `json:"kode" gorm:"type:varchar;size:15;not null" validate:"required"`
-	Nama   string `json:"nama" gorm:"type:varchar;size:200;not null" validate:"required"`
+	Kode   string `json:"kode" gorm:"type:varchar;size:15;not null" validate:"required" sort:"kode"`
+	Nama   string `json:"nama" gorm:"type:varchar;size:200;not null" validate:"required" sort:"nama"`
 	Active *bool  `json:"active" validate:"required"`
 
 	ParentID *string    `json:"parent_id" gorm:"index, type:uuid" validate:"omitempty,uuid4"`
@@ -5,7 +5,7 @@ import "github.com/tigapilarmandiri/perkakas/common/db"
 type SubDirektorat struct {
 	db.Model
 
-	Nama         string      `json:"nama" gorm:"type:varchar;size:200;not null" validate:"required"`
+	Nama         string      `json:"nama" gorm:"type:varchar;size:200;not null" validate:"required" sort:"nama"`
 	DirektoratId *string     `json:"direktorat_id" gorm:"type:uuid"`
 	Direktorat   *Direktorat `json:"direktorat,omitempty"`
 }
@@ -25,16 +25,25 @@ func (ct JenisWilayah) Value() (driver.Value, error) {
 	return string(ct), nil
 }
 
+func (ct JenisWilayah) IsValid() bool {
+	switch ct {
+	case NASIONAL, PROVINSI, KABKOTA, KECAMATAN, DESALURAH:
+		return true
+	}
+
+	return false
+}
+
 type Wilayah struct {
 	db.Model
 
 	ParentID *string  `json:"parent_id" gorm:"index, type:uuid"`
 	Parent   *Wilayah `json:"parent,omitempty" gorm:"foreignKey:ParentID"`
 
-	Kode      string       `json:"kode" gorm:"type:varchar;size:15" validate:"required"`
-	Nama      string       `json:"nama" gorm:"type:varchar;size:255;not null" validate:"required"`
+	Kode      string       `json:"kode" gorm:"type:varchar;size:15" validate:"required" sort:"kode"`
+	Nama      string       `json:"nama" gorm:"type:varchar;size:255;not null" validate:"required" sort:"nama"`
 	Koordinat string       `json:"koordinat" gorm:"type:varchar;size:100"`
-	Jenis     JenisWilayah `json:"jenis" gorm:"type:jenis_wilayah;not null;default:DESALURAH" validate:"required" filter:"jenis"`
+	Jenis     JenisWilayah `json:"jenis" gorm:"type:jenis_wilayah;not null;default:DESALURAH" validate:"required" filter:"jenis" sort:"jenis"`
 	Active    *bool        `json:"active" validate:"required"`
 
 	Kepolisians []*Kepolisian `json:"kepolisians,omitempty" gorm:"many2many:kepolisian_has_wilayah"`